@@ -12,56 +12,109 @@ func createEvent( stub shim.ChaincodeStubInterface, caller string, role string,
 
 	var err error
 	var event Event
+	var t time.Time
 
-	t := time.Now()
 	if( len(caller) == 0 || len(role) == 0 || len(operation) == 0){
-		fmt.Printf("createEvent error: some argument are empty!! %s\n", err.Error())
+		logger.Error("createEvent error: some argument are empty!!\n")
+		return event, fmt.Errorf("createEvent error: some argument are empty!!")
+	}
+	t, err = getTxTime(stub)
+	if err != nil {
+		logger.Error("createEvent error: getTxTime() " + err.Error() + "\n")
 		return event, err
 	}
 
 	event.Caller = caller
 	event.Role = role
 	event.Operation = operation
-	event.Moment = t.String()
+	event.Moment = t.Format(time.RFC3339)
+	event.TxId = stub.GetTxID()
 	return event, nil
 }
 
+//GETTXTIME: the transaction timestamp is set by the client and is the same on every endorser,
+//unlike time.Now()
+
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if txTimestamp == nil {
+		return time.Time{}, fmt.Errorf("transaction timestamp is missing")
+	}
+	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC(), nil
+}
+
+
+//GETTXCREATORINFO: returns the caller's role and identity (MSPID/UID), the role is the one of the certificate
+//unless the RoleAssignment of the identity overrides it. A suspended identity gets a FORBIDDEN error,
+//so every operation consults the on-ledger overlay, see dcotRoles.go.
 
 func getTxCreatorInfo(stub shim.ChaincodeStubInterface) (string, string, error) {
 
-	//var mspid string
+	callerRoles, callerUID, err := getCallerRoles(stub)
+	if err != nil {
+		return "", "", err
+	}
+	return callerRoles[0], callerUID, nil
+}
+
+//GETCALLERROLES: the role returned by getTxCreatorInfo followed by the temporary roles
+//of the caller that are not expired yet, the permission matrix is evaluated on all of them.
+
+func getCallerRoles(stub shim.ChaincodeStubInterface) ([]string, string, error) {
+
+	certificateRole, callerUID, err := getCertificateInfo(stub)
+	if err != nil || len(callerUID) == 0 {
+		return []string{certificateRole}, callerUID, err
+	}
+	callerRoles, suspended, err := getEffectiveRoles(stub, callerUID, certificateRole)
+	if err != nil {
+		return nil, "", err
+	}
+	if suspended {
+		return nil, "", newError(ERR_FORBIDDEN, "", "the user "+callerUID+" is suspended!!")
+	}
+	return callerRoles, callerUID, nil
+}
+
+//GETCERTIFICATEINFO: the role written by the CA in the attributes of the caller's certificate
+//and the identity "MSPID/UID" made of the MSP of the certificate and its uid attribute
+
+func getCertificateInfo(stub shim.ChaincodeStubInterface) (string, string, error) {
+
+	var mspid string
 	var err error
 	var attrValue1, attrValue2 string
 	var found bool
 
-	/*mspid, err = cid.GetMSPID(stub)
+	mspid, err = cid.GetMSPID(stub)
 	if err != nil {
-		fmt.Printf("Error getting MSP identity: %s\n", err.Error())
+		logger.Error("Error getting MSP identity: " + err.Error() + "\n")
 		return "", "", err
-	}*/
+	}
 
 	attrValue1, found, err = cid.GetAttributeValue(stub, ROLE)
 	if err != nil {
-		fmt.Printf("Error getting Attribute Value: %s\n", err.Error())
+		logger.Error("Error getting Attribute Value: " + err.Error() + "\n")
 		return "", "", err
 	}
 	if found == false {
-		fmt.Printf("Error getting ROLE --> NOT FOUND!!!\n")
-	//	err.Error()
-	//	return "", "", err
+		logger.Error("Error getting ROLE --> NOT FOUND!!!\n")
 	}
 
 	attrValue2, found, err = cid.GetAttributeValue(stub, UID)
 	if err != nil {
-		fmt.Printf("Error getting Attribute Value UID: %s\n", err.Error())
+		logger.Error("Error getting Attribute Value UID: " + err.Error() + "\n")
 		return "", "", err
 	}
 	if found == false {
-		fmt.Printf("Error getting UID --> NOT FOUND!!!\n")
-	//	err.Error()
-		return "", "", err
+		logger.Error("Error getting UID --> NOT FOUND!!!\n")
+		return "", "", newError(ERR_FORBIDDEN, "", "the certificate has no uid attribute!!")
 	}
-	return attrValue1, attrValue2 , nil
+	return attrValue1, qualifiedIdentity(mspid, attrValue2) , nil
 }
 
 func isInvokerOperator(stub shim.ChaincodeStubInterface, attrName string) (bool, string, error) {
@@ -71,7 +124,7 @@ func isInvokerOperator(stub shim.ChaincodeStubInterface, attrName string) (bool,
 
 	attrValue, found, err = cid.GetAttributeValue(stub, attrName)
 	if err != nil {
-		fmt.Printf("Error getting Attribute Value: %s\n", err.Error())
+		logger.Error("Error getting Attribute Value: " + err.Error() + "\n")
 		return false, "", err
 	}
 	return found, attrValue, nil
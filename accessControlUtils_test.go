@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEventsCarryTheTransactionTimeAndId(t *testing.T) {
+	var consignment Consignment
+
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+
+	stub.register(t, admin, operator)
+	custodyId := stub.newChain(t, member, "T1")
+	created := stub.getChain(t, custodyId).Event
+	stub.mustInvoke(t, member, "startTransfer", custodyId, "op1")
+
+	event := stub.getChain(t, custodyId).Event
+	if event.Moment != stub.now.UTC().Format(time.RFC3339) || event.TxId != "tx"+strconv.Itoa(stub.txCount) {
+		t.Fatalf("event of startTransfer: moment %s, txId %s", event.Moment, event.TxId)
+	}
+	if event.Operation != "startTransfer" || event.Caller != member.identity() || event.Role != CALLER_ROLE_0 {
+		t.Fatalf("event of startTransfer: %+v", event)
+	}
+	if created.Moment >= event.Moment || created.TxId == event.TxId {
+		t.Fatalf("the events don't follow the transactions: %+v then %+v", created, event)
+	}
+
+	payload := stub.mustInvoke(t, member, "createConsignment")
+	json.Unmarshal(payload, &consignment)
+	if consignment.Event.Moment != stub.now.UTC().Format(time.RFC3339) || consignment.Event.TxId != "tx"+strconv.Itoa(stub.txCount) {
+		t.Fatalf("event of createConsignment: %+v", consignment.Event)
+	}
+}
@@ -6,10 +6,13 @@ type Event struct{
 	Role      string `json:"role"`
 	Operation       string `json:"operation"`
 	Moment string `json:"moment"`
+	TxId      string `json:"txId"`
+	OnBehalfOf string `json:"onBehalfOf,omitempty"` // the delegator, when the caller acts under a Delegation
 
 }
 
 type ChainOfCustody struct {
+	DocType                  string `json:"docType"`
 	Id                       string `json:"id"`
 	TrackingId               string `json:"trackingId"`
 	DocumentId               string `json:"documentId"`
@@ -17,10 +20,150 @@ type ChainOfCustody struct {
 	SortingCenterDestination string `json:"sortingCenterDestination"`
 	DistributionOfficeCode   string `json:"distributionOfficeCode"`
 	DistributionZone         string `json:"distributionZone"`
-	DeliveryMan              string `json:"deliveryMan"`
+	Custodian                string `json:"custodian"`
+	PendingCustodian         string `json:"pendingCustodian"`
+	OwnerOrg                 string `json:"ownerOrg,omitempty"`
+	TransferDeadline         string `json:"transferDeadline,omitempty"`
+	ConsignmentId            string `json:"consignmentId,omitempty"`
+	ParentIds                []string `json:"parentIds,omitempty"`
+	ChildIds                 []string `json:"childIds,omitempty"`
+	ReleaseReason            string `json:"releaseReason,omitempty"`
+	OtpRequired              bool   `json:"otpRequired,omitempty"`
+	OtpSalt                  string `json:"otpSalt,omitempty"`     // legacy layout, read only by migrateChainOfCustody
+	OtpHash                  string `json:"otpHash,omitempty"`     // legacy layout, read only by migrateChainOfCustody
+	ProofOfDelivery          *ProofOfDelivery `json:"proofOfDelivery,omitempty"`
+	DeliveryAttempts         []DeliveryAttempt `json:"deliveryAttempts,omitempty"`
+	InvestigationId          string `json:"investigationId,omitempty"`
+	DeliveryMan              string `json:"deliveryMan,omitempty"`         // legacy layout, read only by migrateChainOfCustody
+	PreviousDeliveryMan      string `json:"previousDeliveryMan,omitempty"` // legacy layout, read only by migrateChainOfCustody
 	CodeOwner                string `json:"codeOwner"`
 	Text                     string `json:"text"`
 	Status                   string `json:"status"`
+	EventCount               int    `json:"eventCount"`
 	Event   `json:"event"`   
+	legacyOtp                *DeliveryOtp // the OTP of a legacy record, stored apart by storeChainOfCustody
 }
 
+type CustodyEvent struct {
+	DocType           string   `json:"docType"`
+	CustodyId         string   `json:"custodyId"`
+	Seq               int      `json:"seq"`
+	PreviousCustodian string   `json:"previousCustodian"`
+	NewCustodian      string   `json:"newCustodian"`
+	PreviousStatus    string   `json:"previousStatus"`
+	NewStatus         string   `json:"newStatus"`
+	Args              []string `json:"args"`
+	Event             `json:"event"`
+}
+
+
+type Participant struct {
+	DocType string `json:"docType"`
+	UID    string `json:"uid"`
+	Role   string `json:"role"`
+	Org    string `json:"org"`
+	Office string `json:"office"`
+	Zone   string `json:"zone"`
+	Active bool   `json:"active"`
+}
+
+type Consignment struct {
+	DocType          string   `json:"docType"`
+	Id               string   `json:"id"`
+	Custodian        string   `json:"custodian"`
+	PendingCustodian string   `json:"pendingCustodian"`
+	TransferDeadline string   `json:"transferDeadline,omitempty"`
+	OwnerOrg         string   `json:"ownerOrg,omitempty"`
+	Status           string   `json:"status"`
+	ParcelIds        []string `json:"parcelIds"`
+	Event            `json:"event"`
+}
+
+type Lineage struct {
+	Id       string           `json:"id"`
+	Parents  []ChainOfCustody `json:"parents"`
+	Children []ChainOfCustody `json:"children"`
+}
+
+type ProofOfDelivery struct {
+	RecipientName string   `json:"recipientName"`
+	SignatureHash string   `json:"signatureHash"`
+	Latitude      *float64 `json:"latitude,omitempty"`
+	Longitude     *float64 `json:"longitude,omitempty"`
+	OtpVerified   bool     `json:"otpVerified"`
+	DeliveredBy   string   `json:"deliveredBy"`
+	Moment        string   `json:"moment"`
+}
+
+type DeliveryOtp struct {
+	DocType    string `json:"docType"`
+	Salt       string `json:"salt"`
+	Hash       string `json:"hash"`
+	Iterations int    `json:"iterations,omitempty"` // 0 for the OTP of a legacy record, hashed with a single sha256
+}
+
+type DeliveryAttempt struct {
+	Reason      string   `json:"reason"`
+	Note        string   `json:"note,omitempty"`
+	Latitude    *float64 `json:"latitude,omitempty"`
+	Longitude   *float64 `json:"longitude,omitempty"`
+	AttemptedBy string   `json:"attemptedBy"`
+	Moment      string   `json:"moment"`
+}
+
+type ChaincodeConfig struct {
+	DocType             string `json:"docType"`
+	MaxDeliveryAttempts int `json:"maxDeliveryAttempts"`
+	Permissions         []Permission `json:"permissions"`
+	RestrictAdminsToOwnerOrg bool `json:"restrictAdminsToOwnerOrg"`
+	DeniedOperations    []string `json:"deniedOperations,omitempty"` // operations without rows and without the default ones
+	MaxDelegationHours  int `json:"maxDelegationHours"` // the longest window of a Delegation
+}
+
+type Investigation struct {
+	DocType         string   `json:"docType"`
+	Id              string   `json:"id"`
+	CustodyId       string   `json:"custodyId"`
+	ExceptionStatus string   `json:"exceptionStatus"`
+	PriorStatus     string   `json:"priorStatus"`
+	Reason          string   `json:"reason"`
+	EvidenceHashes  []string `json:"evidenceHashes"`
+	OpenedBy        string   `json:"openedBy"`
+	OpenedAt        string   `json:"openedAt"`
+	Status          string   `json:"status"`
+	Resolution      string   `json:"resolution,omitempty"`
+	ResolutionNote  string   `json:"resolutionNote,omitempty"`
+	ResolvedBy      string   `json:"resolvedBy,omitempty"`
+	ResolvedAt      string   `json:"resolvedAt,omitempty"`
+}
+type RoleAssignment struct {
+	DocType        string          `json:"docType"`
+	UID            string          `json:"uid"`
+	Suspended      bool            `json:"suspended"`
+	RoleOverride   string          `json:"roleOverride,omitempty"`
+	TemporaryRoles []TemporaryRole `json:"temporaryRoles,omitempty"`
+	AuditCount     int             `json:"auditCount"`
+	Event          `json:"event"`
+}
+type TemporaryRole struct {
+	Role      string `json:"role"`
+	ExpiresAt string `json:"expiresAt"`
+}
+type RoleAuditEntry struct {
+	DocType  string          `json:"docType"`
+	UID      string          `json:"uid"`
+	Seq      int             `json:"seq"`
+	Previous *RoleAssignment `json:"previous,omitempty"`
+	Current  RoleAssignment  `json:"current"`
+	Args     []string        `json:"args"`
+	Event    `json:"event"`
+}
+type Delegation struct {
+	DocType    string `json:"docType"`
+	Delegator  string `json:"delegator"`
+	Delegate   string `json:"delegate"`
+	ValidFrom  string `json:"validFrom"`
+	ValidUntil string `json:"validUntil"`
+	Revoked    bool   `json:"revoked"`
+	Event      `json:"event"`
+}
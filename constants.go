@@ -5,12 +5,67 @@ const (
 	IN_CUSTODY = "IN_CUSTODY"
 	TRANSFER_PENDING = "TRANSFER_PENDING"
 	RELEASED = "RELEASED"
+	DELIVERED = "DELIVERED"
+	RETURN_TO_SENDER = "RETURN_TO_SENDER"
+	RETURN_PENDING = "RETURN_PENDING"
+	RETURNED = "RETURNED"
+	LOST = "LOST"
+	DAMAGED = "DAMAGED"
+	ON_HOLD = "ON_HOLD"
+)
+
+// Reason codes of a failed delivery attempt
+const (
+	ATTEMPT_RECIPIENT_ABSENT = "RECIPIENT_ABSENT"
+	ATTEMPT_WRONG_ADDRESS = "WRONG_ADDRESS"
+	ATTEMPT_REFUSED = "REFUSED"
+	ATTEMPT_ACCESS_DENIED = "ACCESS_DENIED"
+	ATTEMPT_OTHER = "OTHER"
+)
+
+// Release reasons of the records replaced by splitChain and mergeChains
+const (
+	RELEASE_SPLIT = "split"
+	RELEASE_MERGED = "merged"
+	RELEASE_LOSS = "loss"
+)
+
+// Investigation values
+const (
+	INVESTIGATION_OPEN = "OPEN"
+	INVESTIGATION_RESOLVED = "RESOLVED"
+	RESOLUTION_RESTORE = "restore"
+	RESOLUTION_TERMINATE = "terminate"
+)
+
+// Document types, the rich queries select the records of one type by their docType
+const (
+	DOC_TYPE_CHAIN = "chainOfCustody"
+	DOC_TYPE_CUSTODY_EVENT = "custodyEvent"
+	DOC_TYPE_CONSIGNMENT = "consignment"
+	DOC_TYPE_INVESTIGATION = "investigation"
+	DOC_TYPE_PARTICIPANT = "participant"
+	DOC_TYPE_ROLE_ASSIGNMENT = "roleAssignment"
+	DOC_TYPE_ROLE_AUDIT = "roleAudit"
+	DOC_TYPE_DELEGATION = "delegation"
+	DOC_TYPE_CONFIG = "config"
+	DOC_TYPE_DELIVERY_OTP = "deliveryOtp"
+)
+const (
+	TRACKING_ID_PATTERN = `^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`
+	DOCUMENT_ID_PATTERN = `^[A-Za-z0-9][A-Za-z0-9_./-]{0,127}$`
+	SORTING_CENTER_PATTERN = `^[A-Za-z0-9][A-Za-z0-9_ -]{0,63}$`
+	OFFICE_CODE_PATTERN = `^[A-Z0-9]{2,16}$`
+	ZONE_PATTERN = `^[A-Za-z0-9_-]{1,32}$`
+	MAX_TEXT_LENGTH = 1024
 )
 
 
 const (
 	ROLE = "role"
 	UID = "uid"
+	OFFICE = "office"
+	ZONE = "zone"
 )
 
 
@@ -19,5 +74,6 @@ const (
 	CALLER_ROLE_1 = "administrator"
 	CALLER_ROLE_2 = "operator"
 	CALLER_ROLE_3 = "delivery_operator"
+	CALLER_ROLE_4 = "scheduler"
 
 )
\ No newline at end of file
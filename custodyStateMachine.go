@@ -0,0 +1,157 @@
+package main
+
+import (
+	"github.com/looplab/fsm"
+)
+
+// NO_CHAIN is the pseudo-status of a ChainOfCustody that does not exist yet
+const NO_CHAIN = ""
+
+type CustodyTransition struct {
+	Status    string
+	Operation string
+	NextState string
+}
+
+// every role of the chaincode, the scheduler included
+var allRoles = []string{CALLER_ROLE_0, CALLER_ROLE_1, CALLER_ROLE_2, CALLER_ROLE_3, CALLER_ROLE_4}
+
+//CUSTODYTRANSITIONS: every operation on a ChainOfCustody must be listed here,
+//one row for each status in which the operation is allowed.
+//Operations that don't change the status have NextState equal to Status.
+//Who may perform an operation is decided by the permission matrix, see permissionPolicy.go.
+
+var custodyTransitions = []CustodyTransition{
+	{NO_CHAIN, "initNewChain", IN_CUSTODY},
+
+	{IN_CUSTODY, "startTransfer", TRANSFER_PENDING},
+	{TRANSFER_PENDING, "completeTrasfer", IN_CUSTODY},
+	{TRANSFER_PENDING, "cancelTrasfer", IN_CUSTODY},
+	{TRANSFER_PENDING, "rejectTransfer", IN_CUSTODY},
+	{TRANSFER_PENDING, "expireTransfer", IN_CUSTODY},
+
+	{IN_CUSTODY, "recordDeliveryAttempt", IN_CUSTODY},
+	{IN_CUSTODY, "returnToSender", RETURN_TO_SENDER},
+
+	{RETURN_TO_SENDER, "startTransfer", RETURN_PENDING},
+	{RETURN_PENDING, "completeTrasfer", RETURN_TO_SENDER},
+	{RETURN_PENDING, "cancelTrasfer", RETURN_TO_SENDER},
+	{RETURN_PENDING, "rejectTransfer", RETURN_TO_SENDER},
+	{RETURN_PENDING, "expireTransfer", RETURN_TO_SENDER},
+	{RETURN_TO_SENDER, "completeReturn", RETURNED},
+	{RETURN_TO_SENDER, "terminateChain", RELEASED},
+
+	{IN_CUSTODY, "reportLost", LOST},
+	{TRANSFER_PENDING, "reportLost", LOST},
+	{RETURN_TO_SENDER, "reportLost", LOST},
+	{RETURN_PENDING, "reportLost", LOST},
+	{IN_CUSTODY, "reportDamaged", DAMAGED},
+	{TRANSFER_PENDING, "reportDamaged", DAMAGED},
+	{RETURN_TO_SENDER, "reportDamaged", DAMAGED},
+	{RETURN_PENDING, "reportDamaged", DAMAGED},
+	{IN_CUSTODY, "putOnHold", ON_HOLD},
+	{TRANSFER_PENDING, "putOnHold", ON_HOLD},
+	{RETURN_TO_SENDER, "putOnHold", ON_HOLD},
+	{RETURN_PENDING, "putOnHold", ON_HOLD},
+	//restoreException goes back to the status saved in the Investigation, see restoreOperations
+	{LOST, "restoreToInCustody", IN_CUSTODY},
+	{LOST, "restoreToTransferPending", TRANSFER_PENDING},
+	{LOST, "restoreToReturnToSender", RETURN_TO_SENDER},
+	{LOST, "restoreToReturnPending", RETURN_PENDING},
+	{DAMAGED, "restoreToInCustody", IN_CUSTODY},
+	{DAMAGED, "restoreToTransferPending", TRANSFER_PENDING},
+	{DAMAGED, "restoreToReturnToSender", RETURN_TO_SENDER},
+	{DAMAGED, "restoreToReturnPending", RETURN_PENDING},
+	{ON_HOLD, "restoreToInCustody", IN_CUSTODY},
+	{ON_HOLD, "restoreToTransferPending", TRANSFER_PENDING},
+	{ON_HOLD, "restoreToReturnToSender", RETURN_TO_SENDER},
+	{ON_HOLD, "restoreToReturnPending", RETURN_PENDING},
+	{LOST, "closeAsLoss", RELEASED},
+	{DAMAGED, "closeAsLoss", RELEASED},
+	{ON_HOLD, "closeAsLoss", RELEASED},
+	{IN_CUSTODY, "terminateChain", RELEASED},
+	{IN_CUSTODY, "deliverParcel", DELIVERED},
+	{IN_CUSTODY, "updateDocument", IN_CUSTODY},
+
+	{IN_CUSTODY, "commentChain", IN_CUSTODY},
+	{TRANSFER_PENDING, "commentChain", TRANSFER_PENDING},
+	{RELEASED, "commentChain", RELEASED},
+	{DELIVERED, "commentChain", DELIVERED},
+	{RETURN_TO_SENDER, "commentChain", RETURN_TO_SENDER},
+	{RETURN_PENDING, "commentChain", RETURN_PENDING},
+	{RETURNED, "commentChain", RETURNED},
+	{LOST, "commentChain", LOST},
+	{DAMAGED, "commentChain", DAMAGED},
+	{ON_HOLD, "commentChain", ON_HOLD},
+
+	{NO_CHAIN, "createConsignment", IN_CUSTODY},
+	{IN_CUSTODY, "addToConsignment", IN_CUSTODY},
+	{IN_CUSTODY, "removeFromConsignment", IN_CUSTODY},
+	{IN_CUSTODY, "startConsignmentTransfer", TRANSFER_PENDING},
+	{TRANSFER_PENDING, "completeConsignmentTransfer", IN_CUSTODY},
+	{TRANSFER_PENDING, "cancelConsignmentTransfer", IN_CUSTODY},
+	{TRANSFER_PENDING, "rejectConsignmentTransfer", IN_CUSTODY},
+	{TRANSFER_PENDING, "expireConsignmentTransfer", IN_CUSTODY},
+	{IN_CUSTODY, "closeConsignment", RELEASED},
+
+	{IN_CUSTODY, "splitChain", RELEASED},
+	{NO_CHAIN, "splitChain", IN_CUSTODY},
+	{IN_CUSTODY, "mergeChains", RELEASED},
+	{NO_CHAIN, "mergeChains", IN_CUSTODY},
+
+	{IN_CUSTODY, "getAssetDetails", IN_CUSTODY},
+	{TRANSFER_PENDING, "getAssetDetails", TRANSFER_PENDING},
+	{RELEASED, "getAssetDetails", RELEASED},
+	{DELIVERED, "getAssetDetails", DELIVERED},
+	{RETURN_TO_SENDER, "getAssetDetails", RETURN_TO_SENDER},
+	{RETURN_PENDING, "getAssetDetails", RETURN_PENDING},
+	{RETURNED, "getAssetDetails", RETURNED},
+	{LOST, "getAssetDetails", LOST},
+	{DAMAGED, "getAssetDetails", DAMAGED},
+	{ON_HOLD, "getAssetDetails", ON_HOLD},
+}
+
+//RESTOREOPERATIONS: the transition applied by restoreException for each status an exception can be raised from
+
+var restoreOperations = map[string]string{
+	IN_CUSTODY:       "restoreToInCustody",
+	TRANSFER_PENDING: "restoreToTransferPending",
+	RETURN_TO_SENDER: "restoreToReturnToSender",
+	RETURN_PENDING:   "restoreToReturnPending",
+}
+
+func newCustodyFSM(status string) *fsm.FSM {
+	var events fsm.Events
+
+	for _, transition := range custodyTransitions {
+		events = append(events, fsm.EventDesc{
+			Name: transition.Operation,
+			Src:  []string{transition.Status},
+			Dst:  transition.NextState,
+		})
+	}
+	return fsm.NewFSM(status, events, fsm.Callbacks{})
+}
+
+//APPLYTRANSITION: returns the status reached by the ChainOfCustody after the operation,
+//or an error if the operation is not allowed in the current status.
+//The caller's role is checked by the permission matrix before the handler runs.
+
+func applyTransition(operation string, status string) (string, error) {
+
+	custodyFSM := newCustodyFSM(status)
+
+	err := custodyFSM.Event(operation)
+	if err != nil {
+		switch err.(type) {
+		case *fsm.NoTransitionError:
+			//the row exists and has NextState equal to Status
+			return status, nil
+		case *fsm.InvalidEventError:
+			return "", newError(ERR_INVALID_STATE, operation, "Asset status "+status+" is not compatible with this operation!!")
+		default:
+			return "", newError(ERR_INTERNAL, operation, err.Error())
+		}
+	}
+	return custodyFSM.Current(), nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestApplyTransitionFollowsTheTable(t *testing.T) {
+	for _, transition := range custodyTransitions {
+		nextState, err := applyTransition(transition.Operation, transition.Status)
+		if err != nil {
+			t.Errorf("%s from %q: unexpected error %s", transition.Operation, transition.Status, err.Error())
+			continue
+		}
+		if nextState != transition.NextState {
+			t.Errorf("%s from %q: got %s, expected %s", transition.Operation, transition.Status, nextState, transition.NextState)
+		}
+	}
+}
+
+func TestCustodyTransitionsAreDeterministic(t *testing.T) {
+	seen := make(map[string]bool)
+
+	for _, transition := range custodyTransitions {
+		key := transition.Status + "|" + transition.Operation
+		if seen[key] {
+			t.Errorf("%s from %q is listed twice", transition.Operation, transition.Status)
+		}
+		seen[key] = true
+	}
+}
+
+func TestApplyTransitionRejectsOperationsNotInTheTable(t *testing.T) {
+	invalid := []CustodyTransition{
+		{TRANSFER_PENDING, "startTransfer", ""},
+		{IN_CUSTODY, "completeTrasfer", ""},
+		{RELEASED, "startTransfer", ""},
+		{DELIVERED, "terminateChain", ""},
+		{RETURNED, "deliverParcel", ""},
+		{LOST, "startTransfer", ""},
+		{IN_CUSTODY, "restoreToInCustody", ""},
+		{NO_CHAIN, "startTransfer", ""},
+	}
+	for _, transition := range invalid {
+		_, err := applyTransition(transition.Operation, transition.Status)
+		chaincodeError, ok := err.(*ErrorResponse)
+		if !ok || chaincodeError.Code != ERR_INVALID_STATE {
+			t.Errorf("%s from %q: expected %s, got %v", transition.Operation, transition.Status, ERR_INVALID_STATE, err)
+		}
+	}
+}
+
+func TestEveryExceptionCanBeRestoredToItsPriorStatus(t *testing.T) {
+	for exceptionStatus, raiseOperation := range exceptionOperations {
+		for priorStatus, restoreOperation := range restoreOperations {
+			status, err := applyTransition(raiseOperation, priorStatus)
+			if err != nil || status != exceptionStatus {
+				t.Errorf("%s from %s: got %q %v", raiseOperation, priorStatus, status, err)
+				continue
+			}
+			status, err = applyTransition(restoreOperation, status)
+			if err != nil || status != priorStatus {
+				t.Errorf("%s from %s: got %q %v, expected %s", restoreOperation, exceptionStatus, status, err, priorStatus)
+			}
+		}
+	}
+}
+
+func TestInvestigationRestoresTheStatusBeforeTheException(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+	evidence := `["` + sha256Hex("photo") + `"]`
+
+	stub.register(t, admin, operator)
+	custodyId := stub.newChain(t, member, "T1")
+	stub.mustInvoke(t, member, "startTransfer", custodyId, "op1")
+
+	stub.mustInvoke(t, operator, "raiseException", custodyId, `{"status":"ON_HOLD","reason":"customs","evidenceHashes":`+evidence+`}`)
+	if status := stub.getChain(t, custodyId).Status; status != ON_HOLD {
+		t.Fatalf("status after raiseException: %s", status)
+	}
+	stub.expectError(t, ERR_INVALID_STATE, operator, "completeTrasfer", custodyId)
+	stub.expectError(t, ERR_INVALID_STATE, operator, "raiseException", custodyId, `{"status":"LOST","reason":"again","evidenceHashes":`+evidence+`}`)
+
+	stub.mustInvoke(t, operator, "resolveInvestigation", custodyId, `{"resolution":"restore","note":"released by customs"}`)
+	chainOfCustody := stub.getChain(t, custodyId)
+	if chainOfCustody.Status != TRANSFER_PENDING || chainOfCustody.PendingCustodian != operator.identity() || len(chainOfCustody.InvestigationId) != 0 {
+		t.Fatalf("after restore: status %s, pending %s, investigation %s", chainOfCustody.Status, chainOfCustody.PendingCustodian, chainOfCustody.InvestigationId)
+	}
+	stub.mustInvoke(t, operator, "completeTrasfer", custodyId)
+	stub.expectError(t, ERR_INVALID_STATE, operator, "resolveInvestigation", custodyId, `{"resolution":"restore","note":"twice"}`)
+}
+
+func TestInvestigationClosedAsLossReleasesTheParcel(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+	evidence := `["` + sha256Hex("report") + `"]`
+
+	stub.register(t, admin, operator)
+	custodyId := stub.newChain(t, member, "T1")
+	stub.expectError(t, ERR_BAD_ARGS, operator, "raiseException", custodyId, `{"status":"STOLEN","reason":"x","evidenceHashes":`+evidence+`}`)
+	stub.expectError(t, ERR_BAD_ARGS, operator, "raiseException", custodyId, `{"status":"LOST","reason":"x","evidenceHashes":[]}`)
+	stub.mustInvoke(t, operator, "raiseException", custodyId, `{"status":"LOST","reason":"missing at sorting","evidenceHashes":`+evidence+`}`)
+
+	stub.expectError(t, ERR_FORBIDDEN, operator, "resolveInvestigation", custodyId, `{"resolution":"terminate","note":"not found"}`)
+	stub.mustInvoke(t, admin, "resolveInvestigation", custodyId, `{"resolution":"terminate","note":"not found"}`)
+	chainOfCustody := stub.getChain(t, custodyId)
+	if chainOfCustody.Status != RELEASED || chainOfCustody.ReleaseReason != RELEASE_LOSS {
+		t.Fatalf("after closeAsLoss: status %s, reason %s", chainOfCustody.Status, chainOfCustody.ReleaseReason)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+type BatchItemError struct {
+	Index      int          `json:"index"`
+	TrackingId string       `json:"trackingId"`
+	Error      string       `json:"error"`
+	Fields     []FieldError `json:"fields,omitempty"`
+}
+
+//INITNEWCHAINBATCH: the input is a json array of ChainOfCustody, each one is validated like
+//the input of initNewChain and must have a TrackingId unique in the batch,
+//an optional second argument is the client's idempotency key.
+//All the items are validated before writing, if one is not valid nothing is created.
+//The response maps every TrackingId to the generated id.
+//The caller must be a MEMBER/ADMIN!!!
+
+func (t *DcotWorkflowChaincode) initNewChainBatch(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("initNewChainBatch()")
+
+	var err error
+	var callerRole, callerUID string
+	var idempotencyKey string
+	var items []json.RawMessage
+	var byteResp []byte
+
+	chainsOfCustody := []ChainOfCustody{}
+	COCKeys := []string{}
+	itemErrors := []BatchItemError{}
+	createdIds := make(map[string]string)
+
+	if len(args) != 1 && len(args) != 2 {
+		return errorResponse(ERR_BAD_ARGS, "initNewChainBatch", "this method must want one or two arguments!!")
+	}
+	if len(args) == 2 {
+		idempotencyKey = args[1]
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("initNewChainBatch ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("initNewChainBatch", err)
+	}
+	if len(callerUID) == 0 {
+		logger.Error("initNewChainBatch ERROR: caller_UID is empty!!!\n")
+		return errorResponse(ERR_FORBIDDEN, "initNewChainBatch", "caller_UID is empty!!!")
+	}
+	err = json.Unmarshal([]byte(args[0]), &items)
+	if err != nil {
+		logger.Error("initNewChainBatch ERROR: json.Unmarshal()\n")
+		return errorResponse(ERR_BAD_ARGS, "initNewChainBatch", err.Error())
+	}
+	if len(items) == 0 {
+		return errorResponse(ERR_BAD_ARGS, "initNewChainBatch", "the batch is empty!!")
+	}
+
+	for index, item := range items {
+		var chainOfCustody ChainOfCustody
+		var exists bool
+		var fieldErrors []FieldError
+
+		chainOfCustody, fieldErrors = decodeChainOfCustody(item, NEW_CHAIN_FIELDS, NEW_CHAIN_REQUIRED_FIELDS)
+		if len(fieldErrors) != 0 {
+			itemErrors = append(itemErrors, BatchItemError{index, chainOfCustody.TrackingId, "the ChainOfCustody is not valid", fieldErrors})
+			continue
+		}
+		if _, found := createdIds[chainOfCustody.TrackingId]; found {
+			itemErrors = append(itemErrors, BatchItemError{index, chainOfCustody.TrackingId, "Tracking ID is repeated in the batch", nil})
+			continue
+		}
+		chainOfCustody.Id = generateCustodyId(stub, "initNewChainBatch", callerUID, idempotencyKey, index)
+		err = setDeliveryOtp(stub, &chainOfCustody, "")
+		if err != nil {
+			return errorResponseFrom("initNewChainBatch", err)
+		}
+		COCKey, err := getCOCKey(stub, chainOfCustody.Id)
+		if err != nil {
+			return errorResponseFrom("initNewChainBatch", err)
+		}
+		exists, err = recordExists(stub, COCKey)
+		if err != nil {
+			logger.Error("initNewChainBatch ERROR: recordExists()\n")
+			return errorResponseFrom("initNewChainBatch", err)
+		}
+		if exists {
+			itemErrors = append(itemErrors, BatchItemError{index, chainOfCustody.TrackingId, "ChainOfCustody " + chainOfCustody.Id + " already exists", nil})
+			continue
+		}
+		createdIds[chainOfCustody.TrackingId] = chainOfCustody.Id
+		chainsOfCustody = append(chainsOfCustody, chainOfCustody)
+		COCKeys = append(COCKeys, COCKey)
+	}
+	if len(itemErrors) != 0 {
+		byteResp, _ = json.Marshal(itemErrors)
+		logger.Error("initNewChainBatch ERROR: invalid items: " + string(byteResp) + "\n")
+		return errorResponseWithDetails(ERR_BAD_ARGS, "initNewChainBatch", "invalid items", itemErrors)
+	}
+
+	for index := range chainsOfCustody {
+		_, err = storeNewChainOfCustody(stub, COCKeys[index], &chainsOfCustody[index], "initNewChain", callerUID, callerUID, callerRole, []string{string(items[index])})
+		if err != nil {
+			logger.Error("initNewChainBatch ERROR: storeNewChainOfCustody() item " + strconv.Itoa(index) + "\n")
+			return errorResponseFrom("initNewChainBatch", err)
+		}
+	}
+	byteResp, err = json.Marshal(createdIds)
+	if err != nil {
+		logger.Error("initNewChainBatch ERROR: json.Marshal()\n")
+		return errorResponseFrom("initNewChainBatch", err)
+	}
+	err = stub.SetEvent("initNewChainBatch EVENT: ", byteResp)
+	if err != nil {
+		logger.Error("initNewChainBatch ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, "initNewChainBatch", err.Error())
+	}
+	logger.Info("initNewChainBatch EVENT: ", string(byteResp))
+	return shim.Success(byteResp)
+}
+
+type BatchEvent struct {
+	Operation  string   `json:"operation"`
+	Caller     string   `json:"caller"`
+	Target     string   `json:"target,omitempty"`
+	CustodyIds []string `json:"custodyIds"`
+}
+
+//STARTTRANSFERBATCH: args are the json array of the custody ids, the receiver
+//and optionally the RFC3339 deadline. Every ChainOfCustody is checked like in startTransfer, with its rows of the permission matrix,
+//if one fails nothing is transferred.
+
+func (t *DcotWorkflowChaincode) startTransferBatch(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("startTransferBatch()")
+
+	var deadline string
+
+	if len(args) != 2 && len(args) != 3 {
+		return errorResponse(ERR_BAD_ARGS, "startTransferBatch", "this method must want two or three arguments!!")
+	}
+	if len(args) == 3 {
+		deadline = args[2]
+	}
+	return t.transferBatch(stub, "startTransferBatch", "startTransfer", args[0], args[1], args, func(chainOfCustody *ChainOfCustody, callerUID string, callerRole string) error {
+		return prepareStartTransfer(stub, chainOfCustody, callerUID, callerRole, args[1], deadline, "")
+	})
+}
+
+//COMPLETETRANSFERBATCH: the argument is the json array of the custody ids.
+//Every ChainOfCustody is checked like in completeTrasfer, with its rows of the permission matrix, if one fails nothing is transferred.
+
+func (t *DcotWorkflowChaincode) completeTransferBatch(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("completeTransferBatch()")
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, "completeTransferBatch", "this method must want exactly one argument!!")
+	}
+	return t.transferBatch(stub, "completeTransferBatch", "completeTrasfer", args[0], "", args, func(chainOfCustody *ChainOfCustody, callerUID string, callerRole string) error {
+		return prepareCompleteTransfer(stub, chainOfCustody, callerUID, callerRole, "")
+	})
+}
+
+func (t *DcotWorkflowChaincode) transferBatch(stub shim.ChaincodeStubInterface, batchOperation string, operation string, jsonIds string, target string, args []string, prepare func(*ChainOfCustody, string, string) error) pb.Response {
+
+	var err error
+	var callerRole, callerUID string
+	var custodyIds []string
+	var batchEvent BatchEvent
+	var byteResp []byte
+
+	seen := make(map[string]bool)
+
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error(batchOperation + " ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom(batchOperation, err)
+	}
+	err = json.Unmarshal([]byte(jsonIds), &custodyIds)
+	if err != nil {
+		logger.Error(batchOperation + " ERROR: json.Unmarshal()\n")
+		return errorResponse(ERR_BAD_ARGS, batchOperation, err.Error())
+	}
+	if len(custodyIds) == 0 {
+		return errorResponse(ERR_BAD_ARGS, batchOperation, "the batch is empty!!")
+	}
+	if len(target) != 0 {
+		// the event names the receiver like the PendingCustodian of the parcels
+		target = resolveIdentity(callerUID, target)
+	}
+	for _, custodyId := range custodyIds {
+		if seen[custodyId] {
+			return errorResponse(ERR_BAD_ARGS, batchOperation, "custody id "+custodyId+" is repeated in the batch!!")
+		}
+		seen[custodyId] = true
+
+		COCKey, chainOfCustody, previous, err := loadChainOfCustody(stub, custodyId)
+		if err != nil {
+			logger.Error(batchOperation + " ERROR: loadChainOfCustody() " + custodyId + "\n")
+			return errorResponseFrom(batchOperation, wrapError(batchOperation, err, custodyId))
+		}
+		err = checkPermissionOn(stub, operation, chainPermissionSubject(chainOfCustody))
+		if err != nil {
+			logger.Error(batchOperation + " ERROR: " + custodyId + ": " + err.Error() + "\n")
+			return errorResponseFrom(batchOperation, wrapError(batchOperation, err, custodyId))
+		}
+		err = prepare(chainOfCustody, callerUID, callerRole)
+		if err != nil {
+			logger.Error(batchOperation + " ERROR: " + custodyId + ": " + err.Error() + "\n")
+			return errorResponseFrom(batchOperation, wrapError(batchOperation, err, custodyId))
+		}
+		_, err = storeChainOfCustody(stub, COCKey, &previous, chainOfCustody, operation, callerUID, callerRole, args)
+		if err != nil {
+			logger.Error(batchOperation + " ERROR: storeChainOfCustody() " + custodyId + "\n")
+			return errorResponseFrom(batchOperation, err)
+		}
+	}
+	batchEvent = BatchEvent{batchOperation, callerUID, target, custodyIds}
+	byteResp, err = json.Marshal(&batchEvent)
+	if err != nil {
+		logger.Error(batchOperation + " ERROR: json.Marshal()\n")
+		return errorResponseFrom(batchOperation, err)
+	}
+	err = stub.SetEvent(batchOperation+" EVENT: ", byteResp)
+	if err != nil {
+		logger.Error(batchOperation + " ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, batchOperation, err.Error())
+	}
+	logger.Info(batchOperation+" EVENT: ", string(byteResp))
+	return shim.Success(byteResp)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestInitNewChainBatchIsAllOrNothing(t *testing.T) {
+	stub := newTestStub()
+	member := newCaller("m1", CALLER_ROLE_0)
+	valid := `{"trackingId":"T1","documentId":"D1","weightOfParcel":2,"sortingCenterDestination":"SC1","distributionOfficeCode":"RM01"}`
+	invalid := `{"trackingId":"T2","documentId":"D2","weightOfParcel":0,"sortingCenterDestination":"SC1","distributionOfficeCode":"RM01"}`
+	repeated := `{"trackingId":"T1","documentId":"D3","weightOfParcel":1,"sortingCenterDestination":"SC1","distributionOfficeCode":"RM01"}`
+
+	stub.expectError(t, ERR_BAD_ARGS, member, "initNewChainBatch", "["+valid+","+invalid+"]")
+	stub.expectError(t, ERR_BAD_ARGS, member, "initNewChainBatch", "["+valid+","+repeated+"]")
+	if len(stub.State) != 0 {
+		t.Fatalf("a failed batch wrote %d keys", len(stub.State))
+	}
+
+	var createdIds map[string]string
+
+	payload := stub.mustInvoke(t, member, "initNewChainBatch", "["+valid+"]", "client-key-1")
+	err := json.Unmarshal(payload, &createdIds)
+	if err != nil || len(createdIds) != 1 {
+		t.Fatalf("initNewChainBatch response: %s", string(payload))
+	}
+	if status := stub.getChain(t, createdIds["T1"]).Status; status != IN_CUSTODY {
+		t.Fatalf("status of the new ChainOfCustody: %s", status)
+	}
+}
+
+func TestTransferBatchIsAllOrNothing(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	otherMember := newCaller("m2", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+
+	stub.register(t, admin, operator)
+	first := stub.newChain(t, member, "T1")
+	second := stub.newChain(t, member, "T2")
+	foreign := stub.newChain(t, otherMember, "T3")
+
+	stub.expectError(t, ERR_FORBIDDEN, member, "startTransferBatch", `["`+first+`","`+foreign+`"]`, "op1")
+	stub.expectError(t, ERR_BAD_ARGS, member, "startTransferBatch", `["`+first+`","`+first+`"]`, "op1")
+	stub.expectError(t, ERR_BAD_ARGS, member, "startTransferBatch", first, "op1")
+	stub.expectError(t, ERR_NOT_FOUND, member, "startTransferBatch", `["`+first+`","missing"]`, "op1")
+	if status := stub.getChain(t, first).Status; status != IN_CUSTODY {
+		t.Fatalf("a failed batch changed the status of the first parcel to %s", status)
+	}
+
+	var batchEvent BatchEvent
+	payload := stub.mustInvoke(t, member, "startTransferBatch", `["`+first+`","`+second+`"]`, "op1")
+	json.Unmarshal(payload, &batchEvent)
+	if batchEvent.Target != operator.identity() || batchEvent.Target != stub.getChain(t, first).PendingCustodian {
+		t.Fatalf("the event names the receiver %q", batchEvent.Target)
+	}
+	stub.expectError(t, ERR_FORBIDDEN, operator, "completeTransferBatch", `["`+first+`","`+foreign+`"]`)
+	stub.mustInvoke(t, operator, "completeTransferBatch", `["`+first+`","`+second+`"]`)
+	for _, custodyId := range []string{first, second} {
+		chainOfCustody := stub.getChain(t, custodyId)
+		if chainOfCustody.Status != IN_CUSTODY || chainOfCustody.Custodian != operator.identity() {
+			t.Fatalf("%s after the batch: status %s, custodian %s", custodyId, chainOfCustody.Status, chainOfCustody.Custodian)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const CONFIG_KEY = "DCoT_Config"
+
+// the first of the Init arguments when the second one is a ChaincodeConfig
+const INIT_CONFIG_KEY = "config"
+
+const DEFAULT_MAX_DELIVERY_ATTEMPTS = 3
+
+const DEFAULT_MAX_DELEGATION_HOURS = 7 * 24
+
+//SETCONFIG: updates the chaincode configuration, the input json is a ChaincodeConfig,
+//the values missing from it are kept and "permissions" replaces all the stored rows.
+//Returns the configuration in force, see getConfig.
+//The caller must be a Admin!!!
+
+func (t *DcotWorkflowChaincode) setConfig(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("setConfig()")
+
+	var err error
+	var configBytes []byte
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, "setConfig", "this method must want exactly one argument!!")
+	}
+	configBytes, err = putConfig(stub, args[0])
+	if err != nil {
+		logger.Error("setConfig ERROR: putConfig()\n")
+		return errorResponseFrom("setConfig", err)
+	}
+	err = stub.SetEvent("setConfig EVENT: ", configBytes)
+	if err != nil {
+		logger.Error("setConfig ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, "setConfig", err.Error())
+	}
+	logger.Info("setConfig EVENT: ", string(configBytes))
+	return shim.Success(configBytes)
+}
+
+//GETCONFIG: returns the configuration stored in the ledger with the defaults,
+//the operations without stored rows get the ones of defaultPermissions, except the DeniedOperations
+
+func getConfig(stub shim.ChaincodeStubInterface) (ChaincodeConfig, error) {
+
+	config, err := loadStoredConfig(stub)
+	if err != nil {
+		return config, err
+	}
+	setConfigDefaults(&config)
+	return config, nil
+}
+
+//LOADSTOREDCONFIG: the configuration as it was sent by the clients, without the defaults
+
+func loadStoredConfig(stub shim.ChaincodeStubInterface) (ChaincodeConfig, error) {
+	var config ChaincodeConfig
+
+	err := loadRecord(stub, CONFIG_KEY, "ChaincodeConfig", CONFIG_KEY, &config)
+	if err != nil {
+		if chaincodeError, ok := err.(*ErrorResponse); ok && chaincodeError.Code == ERR_NOT_FOUND {
+			return ChaincodeConfig{}, nil
+		}
+		return config, err
+	}
+	return config, nil
+}
+
+//PUTCONFIG: merges the json of a ChaincodeConfig into the stored one, validates the result
+//and writes it in the ledger, it's used by setConfig and by Init.
+//The defaults are not stored, so the operations added by an upgrade get their default rows.
+
+func putConfig(stub shim.ChaincodeStubInterface, jsonConfig string) ([]byte, error) {
+
+	config, err := loadStoredConfig(stub)
+	if err != nil {
+		return nil, err
+	}
+	//only the fields present in jsonConfig are overwritten
+	err = json.Unmarshal([]byte(jsonConfig), &config)
+	if err != nil {
+		return nil, newError(ERR_BAD_ARGS, "", "the configuration is not valid: "+err.Error())
+	}
+	if config.MaxDeliveryAttempts < 0 {
+		return nil, newError(ERR_BAD_ARGS, "", "the maximum number of delivery attempts must not be negative!!")
+	}
+	if config.MaxDelegationHours < 0 {
+		return nil, newError(ERR_BAD_ARGS, "", "the maximum window of a delegation must not be negative!!")
+	}
+	config.DocType = DOC_TYPE_CONFIG
+	err = checkDeniedOperations(config)
+	if err != nil {
+		return nil, err
+	}
+	effective := config
+	setConfigDefaults(&effective)
+	err = checkPermissions(effective.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	configBytes, err := json.Marshal(&config)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.PutState(CONFIG_KEY, configBytes)
+	if err != nil {
+		return nil, newError(ERR_LEDGER, "", err.Error())
+	}
+	return json.Marshal(&effective)
+}
+
+func setConfigDefaults(config *ChaincodeConfig) {
+	if config.MaxDeliveryAttempts == 0 {
+		config.MaxDeliveryAttempts = DEFAULT_MAX_DELIVERY_ATTEMPTS
+	}
+	if config.MaxDelegationHours == 0 {
+		config.MaxDelegationHours = DEFAULT_MAX_DELEGATION_HOURS
+	}
+	configured := make(map[string]bool)
+	for _, permission := range config.Permissions {
+		configured[permission.Operation] = true
+	}
+	for _, operation := range config.DeniedOperations {
+		configured[operation] = true
+	}
+	permissions := append([]Permission{}, config.Permissions...)
+	for _, permission := range defaultPermissions {
+		if !configured[permission.Operation] {
+			permissions = append(permissions, permission)
+		}
+	}
+	config.Permissions = permissions
+}
+
+//CHECKDENIEDOPERATIONS: the DeniedOperations must be known and must not have rows
+
+func checkDeniedOperations(config ChaincodeConfig) error {
+
+	fieldErrors := []FieldError{}
+
+	for index, operation := range config.DeniedOperations {
+		field := "deniedOperations[" + strconv.Itoa(index) + "]"
+		if _, known := operationTargets[operation]; !known {
+			fieldErrors = append(fieldErrors, FieldError{field, "unknown operation " + operation})
+		} else if isOperationConfigured(config.Permissions, operation) {
+			fieldErrors = append(fieldErrors, FieldError{field, operation + " has rows in the permission matrix"})
+		}
+	}
+	if len(fieldErrors) != 0 {
+		deniedError := newError(ERR_BAD_ARGS, "", "the denied operations are not valid!!")
+		deniedError.Details = fieldErrors
+		return deniedError
+	}
+	return nil
+}
+
+func isOperationConfigured(permissions []Permission, operation string) bool {
+	for _, permission := range permissions {
+		if permission.Operation == operation {
+			return true
+		}
+	}
+	return false
+}
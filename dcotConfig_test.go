@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestSetConfigMergesPartialUpdates(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+
+	stub.mustInvoke(t, admin, "setConfig", `{"restrictAdminsToOwnerOrg":true}`)
+	stub.mustInvoke(t, admin, "setConfig", `{"maxDeliveryAttempts":5}`)
+	stub.expectError(t, ERR_BAD_ARGS, admin, "setConfig", `{"maxDeliveryAttempts":-1}`)
+
+	config, err := loadStoredConfig(stub)
+	if err != nil {
+		t.Fatalf("loadStoredConfig: %s", err.Error())
+	}
+	if !config.RestrictAdminsToOwnerOrg || config.MaxDeliveryAttempts != 5 || config.DocType != DOC_TYPE_CONFIG {
+		t.Fatalf("stored config after two partial updates: %+v", config)
+	}
+	if len(config.Permissions) != 0 {
+		t.Fatalf("the default matrix was stored: %d rows", len(config.Permissions))
+	}
+}
+
+func TestOperationsWithoutStoredRowsGetTheDefaultRows(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+
+	stub.register(t, admin, operator)
+	stub.mustInvoke(t, admin, "setConfig", `{"permissions":[{"operation":"commentChain","roles":["`+CALLER_ROLE_1+`"]}]}`)
+	if stored := string(stub.State[CONFIG_KEY]); strings.Contains(stored, "startTransfer") {
+		t.Fatalf("the default rows were stored: %s", stored)
+	}
+
+	custodyId := stub.newChain(t, member, "T1")
+	stub.mustInvoke(t, member, "startTransfer", custodyId, "op1")
+	stub.mustInvoke(t, operator, "completeTrasfer", custodyId)
+	stub.expectError(t, ERR_FORBIDDEN, operator, "commentChain", custodyId, "checked")
+	stub.mustInvoke(t, admin, "commentChain", custodyId, "checked")
+
+	stub.mustInvoke(t, admin, "setConfig", `{"permissions":[]}`)
+	stub.mustInvoke(t, operator, "commentChain", custodyId, "checked again")
+}
+
+func TestDeniedOperationsGetNoDefaultRows(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+
+	custodyId := stub.newChain(t, member, "T1")
+	stub.expectError(t, ERR_BAD_ARGS, admin, "setConfig", `{"deniedOperations":["fly"]}`)
+	stub.expectError(t, ERR_BAD_ARGS, admin, "setConfig", `{"deniedOperations":["setConfig"]}`)
+	stub.expectError(t, ERR_BAD_ARGS, admin, "setConfig", `{"deniedOperations":["commentChain"],"permissions":[{"operation":"commentChain","roles":["`+CALLER_ROLE_1+`"]}]}`)
+	stub.mustInvoke(t, admin, "setConfig", `{"deniedOperations":["commentChain"]}`)
+	stub.expectError(t, ERR_FORBIDDEN, admin, "commentChain", custodyId, "denied")
+	stub.mustInvoke(t, admin, "setConfig", `{"deniedOperations":[]}`)
+	stub.mustInvoke(t, admin, "commentChain", custodyId, "allowed again")
+}
+
+func TestInitReadsTheConfigurationOnlyAfterTheConfigKey(t *testing.T) {
+	stub := newTestStub()
+
+	stub.function, stub.args = "a", []string{"10"}
+	stub.MockTransactionStart("init1")
+	response := new(DcotWorkflowChaincode).Init(stub)
+	stub.MockTransactionEnd("init1")
+	if response.Status != shim.OK {
+		t.Fatalf("Init with the legacy arguments: %s", response.Message)
+	}
+
+	stub.function, stub.args = INIT_CONFIG_KEY, []string{`{"maxDeliveryAttempts":4}`}
+	stub.MockTransactionStart("init2")
+	response = new(DcotWorkflowChaincode).Init(stub)
+	stub.MockTransactionEnd("init2")
+	if response.Status != shim.OK {
+		t.Fatalf("Init with a configuration: %s", response.Message)
+	}
+	config, err := getConfig(stub)
+	if err != nil || config.MaxDeliveryAttempts != 4 {
+		t.Fatalf("configuration after Init: %+v %v", config, err)
+	}
+}
+
+func TestConfigErrorsHaveTheirCodes(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+
+	stub.expectError(t, ERR_BAD_ARGS, admin, "setConfig", `{"maxDeliveryAttempts":"three"}`)
+	stub.expectError(t, ERR_BAD_ARGS, admin, "setConfig", `not json`)
+
+	stub.MockTransactionStart("corrupt")
+	stub.PutState(CONFIG_KEY, []byte(`{"permissions":`))
+	stub.MockTransactionEnd("corrupt")
+	stub.expectError(t, ERR_CORRUPT_RECORD, admin, "setConfig", `{"maxDeliveryAttempts":3}`)
+}
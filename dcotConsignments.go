@@ -0,0 +1,541 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//CREATECONSIGNMENT: creates an empty consignment (bag, roll cage...) in custody of the caller,
+//an optional argument is the client's idempotency key.
+
+func (t *DcotWorkflowChaincode) createConsignment(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("createConsignment()")
+
+	var err error
+	var callerRole, callerUID string
+	var idempotencyKey string
+	var consignment Consignment
+	var consignmentKey string
+	var exists bool
+	var byteConsignment []byte
+
+	operation := "createConsignment"
+
+	if len(args) > 1 {
+		return errorResponse(ERR_BAD_ARGS, "createConsignment", "this method must want at most one argument!!")
+	}
+	if len(args) == 1 {
+		idempotencyKey = args[0]
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("createConsignment ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("createConsignment", err)
+	}
+	consignment.Status, err = applyTransition(operation, NO_CHAIN)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("createConsignment", err)
+	}
+	consignment.Id = generateCustodyId(stub, operation, callerUID, idempotencyKey, 0)
+	consignmentKey, err = getConsignmentKey(stub, consignment.Id)
+	if err != nil {
+		return errorResponseFrom("createConsignment", err)
+	}
+	exists, err = recordExists(stub, consignmentKey)
+	if err != nil {
+		logger.Error("createConsignment ERROR: recordExists()\n")
+		return errorResponseFrom("createConsignment", err)
+	}
+	if exists {
+		logger.Error("createConsignment ERROR: Consignment " + consignment.Id + " already exists!!\n")
+		return errorResponse(ERR_ALREADY_EXISTS, "createConsignment", "Consignment "+consignment.Id+" already exists!!")
+	}
+	consignment.Custodian = callerUID
+	consignment.OwnerOrg = identityOrg(callerUID)
+	consignment.ParcelIds = []string{}
+	byteConsignment, err = storeConsignment(stub, consignmentKey, &consignment, operation, callerUID, callerRole)
+	if err != nil {
+		logger.Error("createConsignment ERROR: storeConsignment()\n")
+		return errorResponseFrom("createConsignment", err)
+	}
+	return shim.Success(byteConsignment)
+}
+
+//ADDTOCONSIGNMENT: args are the consignment id and the json array of the custody ids.
+//The consignment and the parcels must be 'IN_CUSTODY' and the caller must be their custodian!!
+
+func (t *DcotWorkflowChaincode) addToConsignment(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+	return t.updateConsignmentParcels(stub, "addToConsignment", args)
+}
+
+//REMOVEFROMCONSIGNMENT: args are the consignment id and the json array of the custody ids.
+//The consignment must be 'IN_CUSTODY' and the caller must be its custodian!!
+
+func (t *DcotWorkflowChaincode) removeFromConsignment(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+	return t.updateConsignmentParcels(stub, "removeFromConsignment", args)
+}
+
+func (t *DcotWorkflowChaincode) updateConsignmentParcels(stub shim.ChaincodeStubInterface, operation string, args []string) pb.Response {
+
+	logger.Debug(operation + "()")
+
+	var err error
+	var callerRole, callerUID string
+	var consignmentKey string
+	var consignment *Consignment
+	var custodyIds []string
+	var byteConsignment []byte
+
+	seen := make(map[string]bool)
+
+	if len(args) != 2 {
+		return errorResponse(ERR_BAD_ARGS, operation, "this method must want exactly two arguments!!")
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error(operation + " ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom(operation, err)
+	}
+	consignmentKey, consignment, err = loadConsignment(stub, args[0])
+	if err != nil {
+		logger.Error(operation + " ERROR: loadConsignment()\n")
+		return errorResponseFrom(operation, err)
+	}
+	consignment.Status, err = applyTransition(operation, consignment.Status)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom(operation, err)
+	}
+	err = json.Unmarshal([]byte(args[1]), &custodyIds)
+	if err != nil {
+		logger.Error(operation + " ERROR: json.Unmarshal()\n")
+		return errorResponse(ERR_BAD_ARGS, operation, err.Error())
+	}
+	if len(custodyIds) == 0 {
+		return errorResponse(ERR_BAD_ARGS, operation, "the list of parcels is empty!!")
+	}
+
+	for _, custodyId := range custodyIds {
+		// the peer doesn't read its own writes, a repeated id would be added to the consignment twice
+		if seen[custodyId] {
+			return errorResponse(ERR_BAD_ARGS, operation, "custody id "+custodyId+" is repeated in the list!!")
+		}
+		seen[custodyId] = true
+
+		COCKey, chainOfCustody, previous, err := loadChainOfCustody(stub, custodyId)
+		if err != nil {
+			logger.Error(operation + " ERROR: loadChainOfCustody() " + custodyId + "\n")
+			return errorResponseFrom(operation, wrapError(operation, err, custodyId))
+		}
+		delegated, err := actsFor(stub, callerUID, chainOfCustody.Custodian)
+		if err != nil {
+			logger.Error(operation + " ERROR: actsFor() " + custodyId + "\n")
+			return errorResponseFrom(operation, err)
+		}
+		if !delegated {
+			logger.Error(operation + " ERROR : The caller must be the current custodian of " + custodyId + "!!\n")
+			return errorResponse(ERR_FORBIDDEN, operation, "The caller must be the current custodian of "+custodyId+"!!")
+		}
+		chainOfCustody.Status, err = applyTransition(operation, chainOfCustody.Status)
+		if err != nil {
+			logger.Error(err.Error())
+			return errorResponseFrom(operation, wrapError(operation, err, custodyId))
+		}
+		if operation == "addToConsignment" {
+			err = checkConsignment(chainOfCustody, operation, "")
+			if err == nil {
+				chainOfCustody.ConsignmentId = consignment.Id
+				consignment.ParcelIds = append(consignment.ParcelIds, custodyId)
+			}
+		} else {
+			err = checkConsignment(chainOfCustody, operation, consignment.Id)
+			if err == nil {
+				chainOfCustody.ConsignmentId = ""
+				consignment.ParcelIds = removeId(consignment.ParcelIds, custodyId)
+			}
+		}
+		if err != nil {
+			logger.Error(err.Error())
+			return errorResponseFrom(operation, wrapError(operation, err, custodyId))
+		}
+		_, err = storeChainOfCustody(stub, COCKey, &previous, chainOfCustody, operation, callerUID, callerRole, []string{consignment.Id})
+		if err != nil {
+			logger.Error(operation + " ERROR: storeChainOfCustody() " + custodyId + "\n")
+			return errorResponseFrom(operation, err)
+		}
+	}
+	byteConsignment, err = storeConsignment(stub, consignmentKey, consignment, operation, callerUID, callerRole)
+	if err != nil {
+		logger.Error(operation + " ERROR: storeConsignment()\n")
+		return errorResponseFrom(operation, err)
+	}
+	return shim.Success(byteConsignment)
+}
+
+//STARTCONSIGNMENTTRANSFER: args are the consignment id, the receiver, a bare UID is in the caller's organization,
+//and optionally the RFC3339 deadline, every parcel inside the consignment is transferred to the same receiver.
+//The caller must be the current custodian of the consignment!!
+
+func (t *DcotWorkflowChaincode) startConsignmentTransfer(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("startConsignmentTransfer()")
+
+	var err error
+	var callerRole, callerUID string
+	var consignmentKey string
+	var consignment *Consignment
+	var byteConsignment []byte
+	var deadline string
+
+	operation := "startConsignmentTransfer"
+
+	if len(args) != 2 && len(args) != 3 {
+		return errorResponse(ERR_BAD_ARGS, "startConsignmentTransfer", "this method must want two or three arguments!!")
+	}
+	if len(args) == 3 {
+		deadline = args[2]
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("startConsignmentTransfer ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("startConsignmentTransfer", err)
+	}
+	consignmentKey, consignment, err = loadConsignment(stub, args[0])
+	if err != nil {
+		logger.Error("startConsignmentTransfer ERROR: loadConsignment()\n")
+		return errorResponseFrom("startConsignmentTransfer", err)
+	}
+	consignment.Status, err = applyTransition(operation, consignment.Status)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("startConsignmentTransfer", err)
+	}
+	receiver := resolveIdentity(callerUID, args[1])
+	err = checkReceiver(stub, operation, receiver, nil)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("startConsignmentTransfer", err)
+	}
+	consignment.PendingCustodian = receiver
+	consignment.TransferDeadline, err = checkDeadline(stub, operation, deadline)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("startConsignmentTransfer", err)
+	}
+
+	// every parcel is checked like in startTransfer, the consignment is no way around the matrix
+	err = forEachConsignedParcel(stub, consignment, operation, callerUID, callerRole, args, func(chainOfCustody *ChainOfCustody) error {
+		err := checkPermissionOn(stub, "startTransfer", chainPermissionSubject(chainOfCustody))
+		if err != nil {
+			return err
+		}
+		return prepareStartTransfer(stub, chainOfCustody, callerUID, callerRole, receiver, deadline, consignment.Id)
+	})
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("startConsignmentTransfer", err)
+	}
+	byteConsignment, err = storeConsignment(stub, consignmentKey, consignment, operation, callerUID, callerRole)
+	if err != nil {
+		logger.Error("startConsignmentTransfer ERROR: storeConsignment()\n")
+		return errorResponseFrom("startConsignmentTransfer", err)
+	}
+	return shim.Success(byteConsignment)
+}
+
+//COMPLETECONSIGNMENTTRANSFER: the receiver takes the custody of the consignment
+//and of every parcel inside it.
+//The caller must be the designed receiver of the consignment!!
+
+func (t *DcotWorkflowChaincode) completeConsignmentTransfer(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("completeConsignmentTransfer()")
+
+	var err error
+	var callerRole, callerUID string
+	var consignmentKey string
+	var consignment *Consignment
+	var byteConsignment []byte
+
+	operation := "completeConsignmentTransfer"
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, "completeConsignmentTransfer", "this method must want exactly one argument!!")
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("completeConsignmentTransfer ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("completeConsignmentTransfer", err)
+	}
+	consignmentKey, consignment, err = loadConsignment(stub, args[0])
+	if err != nil {
+		logger.Error("completeConsignmentTransfer ERROR: loadConsignment()\n")
+		return errorResponseFrom("completeConsignmentTransfer", err)
+	}
+	consignment.Status, err = applyTransition(operation, consignment.Status)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("completeConsignmentTransfer", err)
+	}
+	consignment.Custodian = consignment.PendingCustodian
+	consignment.PendingCustodian = ""
+	consignment.TransferDeadline = ""
+
+	err = forEachConsignedParcel(stub, consignment, operation, callerUID, callerRole, args, func(chainOfCustody *ChainOfCustody) error {
+		err := checkPermissionOn(stub, "completeTrasfer", chainPermissionSubject(chainOfCustody))
+		if err != nil {
+			return err
+		}
+		return prepareCompleteTransfer(stub, chainOfCustody, callerUID, callerRole, consignment.Id)
+	})
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("completeConsignmentTransfer", err)
+	}
+	byteConsignment, err = storeConsignment(stub, consignmentKey, consignment, operation, callerUID, callerRole)
+	if err != nil {
+		logger.Error("completeConsignmentTransfer ERROR: storeConsignment()\n")
+		return errorResponseFrom("completeConsignmentTransfer", err)
+	}
+	return shim.Success(byteConsignment)
+}
+
+//CANCELCONSIGNMENTTRANSFER: the argument is the consignment id, the consignment and every parcel inside it
+//stay with the current custodian.
+//The caller must be a Admin or the current custodian of the consignment!!
+
+func (t *DcotWorkflowChaincode) cancelConsignmentTransfer(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+	return t.endConsignmentTransfer(stub, "cancelConsignmentTransfer", "cancelTrasfer", args)
+}
+
+//REJECTCONSIGNMENTTRANSFER: the argument is the consignment id, the consignment and every parcel inside it
+//stay with the current custodian.
+//The caller must be the designed receiver of the consignment!!
+
+func (t *DcotWorkflowChaincode) rejectConsignmentTransfer(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+	return t.endConsignmentTransfer(stub, "rejectConsignmentTransfer", "rejectTransfer", args)
+}
+
+func (t *DcotWorkflowChaincode) endConsignmentTransfer(stub shim.ChaincodeStubInterface, operation string, parcelOperation string, args []string) pb.Response {
+
+	logger.Debug(operation + "()")
+
+	var err error
+	var callerRole, callerUID string
+	var consignmentKey string
+	var consignment *Consignment
+	var byteConsignment []byte
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, operation, "this method must want exactly one argument!!")
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error(operation + " ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom(operation, err)
+	}
+	consignmentKey, consignment, err = loadConsignment(stub, args[0])
+	if err != nil {
+		logger.Error(operation + " ERROR: loadConsignment()\n")
+		return errorResponseFrom(operation, err)
+	}
+	byteConsignment, err = endPendingConsignmentTransfer(stub, consignmentKey, consignment, operation, parcelOperation, callerUID, callerRole)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom(operation, err)
+	}
+	return shim.Success(byteConsignment)
+}
+
+//ENDPENDINGCONSIGNMENTTRANSFER: the consignment goes back to 'IN_CUSTODY' with the current custodian
+//and parcelOperation is applied to every parcel inside it, both are stored
+
+func endPendingConsignmentTransfer(stub shim.ChaincodeStubInterface, consignmentKey string, consignment *Consignment, operation string, parcelOperation string, callerUID string, callerRole string) ([]byte, error) {
+
+	var err error
+
+	consignment.Status, err = applyTransition(operation, consignment.Status)
+	if err != nil {
+		return nil, err
+	}
+	consignment.PendingCustodian = ""
+	consignment.TransferDeadline = ""
+
+	err = forEachConsignedParcel(stub, consignment, parcelOperation, callerUID, callerRole, []string{consignment.Id}, func(chainOfCustody *ChainOfCustody) error {
+		return prepareEndTransfer(chainOfCustody, parcelOperation, consignment.Id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return storeConsignment(stub, consignmentKey, consignment, operation, callerUID, callerRole)
+}
+
+//CLOSECONSIGNMENT: the consignment must be empty and 'IN_CUSTODY',
+//the caller must be its current custodian!!
+
+func (t *DcotWorkflowChaincode) closeConsignment(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("closeConsignment()")
+
+	var err error
+	var callerRole, callerUID string
+	var consignmentKey string
+	var consignment *Consignment
+	var byteConsignment []byte
+
+	operation := "closeConsignment"
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, "closeConsignment", "this method must want exactly one argument!!")
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("closeConsignment ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("closeConsignment", err)
+	}
+	consignmentKey, consignment, err = loadConsignment(stub, args[0])
+	if err != nil {
+		logger.Error("closeConsignment ERROR: loadConsignment()\n")
+		return errorResponseFrom("closeConsignment", err)
+	}
+	if len(consignment.ParcelIds) != 0 {
+		logger.Error("closeConsignment ERROR : the consignment is not empty!!\n")
+		return errorResponse(ERR_INVALID_STATE, "closeConsignment", "the consignment is not empty!!")
+	}
+	consignment.Status, err = applyTransition(operation, consignment.Status)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("closeConsignment", err)
+	}
+	byteConsignment, err = storeConsignment(stub, consignmentKey, consignment, operation, callerUID, callerRole)
+	if err != nil {
+		logger.Error("closeConsignment ERROR: storeConsignment()\n")
+		return errorResponseFrom("closeConsignment", err)
+	}
+	return shim.Success(byteConsignment)
+}
+
+//GETCONSIGNMENTDETAILS
+//The caller must have the same roles required by getAssetDetails!!
+
+func (t *DcotWorkflowChaincode) getConsignmentDetails(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("getConsignmentDetails()")
+
+	var err error
+	var consignment *Consignment
+	var byteConsignment []byte
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, "getConsignmentDetails", "this method must want exactly one argument!!")
+	}
+	_, consignment, err = loadConsignment(stub, args[0])
+	if err != nil {
+		logger.Error("getConsignmentDetails ERROR: loadConsignment()\n")
+		return errorResponseFrom("getConsignmentDetails", err)
+	}
+	byteConsignment, err = json.Marshal(consignment)
+	if err != nil {
+		logger.Error("getConsignmentDetails ERROR: json.Marshal()\n")
+		return errorResponseFrom("getConsignmentDetails", err)
+	}
+	return shim.Success(byteConsignment)
+}
+
+//FOREACHCONSIGNEDPARCEL: applies prepare to every parcel inside the consignment
+//and stores it, the parcel's event log records the consignment operation
+
+func forEachConsignedParcel(stub shim.ChaincodeStubInterface, consignment *Consignment, operation string, callerUID string, callerRole string, args []string, prepare func(*ChainOfCustody) error) error {
+
+	for _, custodyId := range consignment.ParcelIds {
+		COCKey, chainOfCustody, previous, err := loadChainOfCustody(stub, custodyId)
+		if err != nil {
+			return wrapError(operation, err, custodyId)
+		}
+		err = prepare(chainOfCustody)
+		if err != nil {
+			return wrapError(operation, err, custodyId)
+		}
+		_, err = storeChainOfCustody(stub, COCKey, &previous, chainOfCustody, operation, callerUID, callerRole, args)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadConsignment(stub shim.ChaincodeStubInterface, consignmentId string) (string, *Consignment, error) {
+	var consignment Consignment
+
+	consignmentKey, err := getConsignmentKey(stub, consignmentId)
+	if err != nil {
+		return "", nil, newError(ERR_BAD_ARGS, "", err.Error())
+	}
+	err = loadRecord(stub, consignmentKey, "Consignment", consignmentId, &consignment)
+	if err != nil {
+		return "", nil, err
+	}
+	return consignmentKey, &consignment, nil
+}
+
+func storeConsignment(stub shim.ChaincodeStubInterface, consignmentKey string, consignment *Consignment, operation string, callerUID string, callerRole string) ([]byte, error) {
+
+	var err error
+	var previous Consignment
+
+	consignment.DocType = DOC_TYPE_CONSIGNMENT
+	consignment.Event, err = createEvent(stub, callerUID, callerRole, operation)
+	if err != nil {
+		return nil, err
+	}
+	byteConsignment, err := json.Marshal(consignment)
+	if err != nil {
+		return nil, err
+	}
+	// the entry of the deadline index of the stored consignment, if any, is replaced
+	err = loadRecord(stub, consignmentKey, "Consignment", consignment.Id, &previous)
+	if err != nil {
+		if chaincodeError, ok := err.(*ErrorResponse); !ok || chaincodeError.Code != ERR_NOT_FOUND {
+			return nil, err
+		}
+	}
+	err = stub.PutState(consignmentKey, byteConsignment)
+	if err != nil {
+		return nil, newError(ERR_LEDGER, "", err.Error())
+	}
+	// expirePendingTransfers finds the consignments with an expired deadline in this index
+	expiring := len(consignment.TransferDeadline) != 0 && consignment.Status == TRANSFER_PENDING
+	if len(previous.TransferDeadline) != 0 && (!expiring || previous.TransferDeadline != consignment.TransferDeadline) {
+		err = stub.DelState(getDeadlineKey(previous.TransferDeadline, DOC_TYPE_CONSIGNMENT, consignment.Id))
+		if err != nil {
+			return nil, newError(ERR_LEDGER, "", err.Error())
+		}
+	}
+	if expiring {
+		err = stub.PutState(getDeadlineKey(consignment.TransferDeadline, DOC_TYPE_CONSIGNMENT, consignment.Id), []byte{0x00})
+		if err != nil {
+			return nil, newError(ERR_LEDGER, "", err.Error())
+		}
+	}
+	err = stub.SetEvent(operation+" EVENT: ", byteConsignment)
+	if err != nil {
+		return nil, newError(ERR_LEDGER, "", err.Error())
+	}
+	logger.Info(operation+" EVENT: ", string(byteConsignment))
+	return byteConsignment, nil
+}
+
+func removeId(ids []string, id string) []string {
+	remaining := []string{}
+
+	for _, current := range ids {
+		if current != id {
+			remaining = append(remaining, current)
+		}
+	}
+	return remaining
+}
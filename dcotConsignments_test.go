@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestConsignmentLifecycle(t *testing.T) {
+	var consignment Consignment
+
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+
+	stub.register(t, admin, operator)
+	first := stub.newChain(t, member, "T1")
+	second := stub.newChain(t, member, "T2")
+	payload := stub.mustInvoke(t, member, "createConsignment")
+	err := json.Unmarshal(payload, &consignment)
+	if err != nil {
+		t.Fatalf("createConsignment response: %s", string(payload))
+	}
+	consignmentId := consignment.Id
+
+	stub.expectError(t, ERR_BAD_ARGS, member, "addToConsignment", consignmentId, `["`+first+`","`+first+`"]`)
+	stub.mustInvoke(t, member, "addToConsignment", consignmentId, `["`+first+`","`+second+`"]`)
+	stub.expectError(t, ERR_BAD_ARGS, member, "removeFromConsignment", consignmentId, `["`+second+`","`+second+`"]`)
+	stub.expectError(t, ERR_INVALID_STATE, member, "addToConsignment", consignmentId, `["`+first+`"]`)
+	stub.expectError(t, ERR_INVALID_STATE, member, "startTransfer", first, "op1")
+	stub.expectError(t, ERR_INVALID_STATE, operator, "raiseException", first, `{"status":"LOST","reason":"missing","evidenceHashes":["`+sha256Hex("report")+`"]}`)
+	stub.mustInvoke(t, member, "removeFromConsignment", consignmentId, `["`+second+`"]`)
+	if parcelIds := stub.getConsignment(t, consignmentId).ParcelIds; len(parcelIds) != 1 || parcelIds[0] != first {
+		t.Fatalf("parcels after removeFromConsignment: %v", parcelIds)
+	}
+
+	stub.mustInvoke(t, member, "startConsignmentTransfer", consignmentId, "op1")
+	if chainOfCustody := stub.getChain(t, first); chainOfCustody.Status != TRANSFER_PENDING || chainOfCustody.PendingCustodian != operator.identity() {
+		t.Fatalf("consigned parcel after startConsignmentTransfer: status %s, pending %s", chainOfCustody.Status, chainOfCustody.PendingCustodian)
+	}
+	stub.expectError(t, ERR_INVALID_STATE, operator, "completeTrasfer", first)
+	stub.expectError(t, ERR_FORBIDDEN, member, "completeConsignmentTransfer", consignmentId)
+	stub.mustInvoke(t, operator, "completeConsignmentTransfer", consignmentId)
+	consignment = *stub.getConsignment(t, consignmentId)
+	if consignment.Status != IN_CUSTODY || consignment.Custodian != operator.identity() {
+		t.Fatalf("consignment after completeConsignmentTransfer: status %s, custodian %s", consignment.Status, consignment.Custodian)
+	}
+	if chainOfCustody := stub.getChain(t, first); chainOfCustody.Status != IN_CUSTODY || chainOfCustody.Custodian != operator.identity() {
+		t.Fatalf("consigned parcel after completeConsignmentTransfer: status %s, custodian %s", chainOfCustody.Status, chainOfCustody.Custodian)
+	}
+
+	stub.expectError(t, ERR_INVALID_STATE, operator, "closeConsignment", consignmentId)
+	stub.mustInvoke(t, operator, "removeFromConsignment", consignmentId, `["`+first+`"]`)
+	stub.mustInvoke(t, operator, "closeConsignment", consignmentId)
+	if status := stub.getConsignment(t, consignmentId).Status; status != RELEASED {
+		t.Fatalf("consignment after closeConsignment: %s", status)
+	}
+	if consignmentId := stub.getChain(t, first).ConsignmentId; len(consignmentId) != 0 {
+		t.Fatalf("parcel still inside %s", consignmentId)
+	}
+}
+
+func TestPendingConsignmentTransferCanBeEnded(t *testing.T) {
+	var consignment Consignment
+	var report ExpiryReport
+
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+	scheduler := newCaller("cron", CALLER_ROLE_4)
+
+	stub.register(t, admin, operator)
+	stub.register(t, admin, scheduler)
+	custodyId := stub.newChain(t, member, "T1")
+	payload := stub.mustInvoke(t, member, "createConsignment")
+	json.Unmarshal(payload, &consignment)
+	consignmentId := consignment.Id
+	stub.mustInvoke(t, member, "addToConsignment", consignmentId, `["`+custodyId+`"]`)
+
+	expectReturned := func(step string) {
+		t.Helper()
+		consignment := stub.getConsignment(t, consignmentId)
+		if consignment.Status != IN_CUSTODY || len(consignment.PendingCustodian) != 0 || len(consignment.TransferDeadline) != 0 || consignment.Custodian != member.identity() {
+			t.Fatalf("consignment after %s: status %s, pending %q, deadline %q", step, consignment.Status, consignment.PendingCustodian, consignment.TransferDeadline)
+		}
+		chainOfCustody := stub.getChain(t, custodyId)
+		if chainOfCustody.Status != IN_CUSTODY || len(chainOfCustody.PendingCustodian) != 0 || chainOfCustody.Custodian != member.identity() || chainOfCustody.ConsignmentId != consignmentId {
+			t.Fatalf("consigned parcel after %s: status %s, pending %q, custodian %s", step, chainOfCustody.Status, chainOfCustody.PendingCustodian, chainOfCustody.Custodian)
+		}
+	}
+
+	stub.mustInvoke(t, member, "startConsignmentTransfer", consignmentId, "op1")
+	stub.expectError(t, ERR_INVALID_STATE, member, "cancelTrasfer", custodyId)
+	stub.expectError(t, ERR_FORBIDDEN, operator, "cancelConsignmentTransfer", consignmentId)
+	stub.mustInvoke(t, member, "cancelConsignmentTransfer", consignmentId)
+	expectReturned("cancelConsignmentTransfer")
+	stub.expectError(t, ERR_INVALID_STATE, member, "cancelConsignmentTransfer", consignmentId)
+
+	stub.mustInvoke(t, member, "startConsignmentTransfer", consignmentId, "op1")
+	stub.expectError(t, ERR_INVALID_STATE, operator, "rejectTransfer", custodyId)
+	stub.expectError(t, ERR_FORBIDDEN, member, "rejectConsignmentTransfer", consignmentId)
+	stub.mustInvoke(t, operator, "rejectConsignmentTransfer", consignmentId)
+	expectReturned("rejectConsignmentTransfer")
+
+	deadline := stub.now.Add(time.Hour)
+	stub.expectError(t, ERR_BAD_ARGS, member, "startConsignmentTransfer", consignmentId, "op1", stub.now.Format(time.RFC3339))
+	stub.mustInvoke(t, member, "startConsignmentTransfer", consignmentId, "op1", deadline.Format(time.RFC3339))
+	if consignment := stub.getConsignment(t, consignmentId); consignment.TransferDeadline != deadline.UTC().Format(time.RFC3339) {
+		t.Fatalf("deadline of the consignment: %q", consignment.TransferDeadline)
+	}
+	payload = stub.mustInvoke(t, scheduler, "expirePendingTransfers")
+	json.Unmarshal(payload, &report)
+	if len(report.Expired) != 0 || stub.getConsignment(t, consignmentId).Status != TRANSFER_PENDING {
+		t.Fatalf("expired before the deadline: %v", report.Expired)
+	}
+	stub.now = deadline
+	payload = stub.mustInvoke(t, scheduler, "expirePendingTransfers")
+	json.Unmarshal(payload, &report)
+	if len(report.Expired) != 1 || report.Expired[0] != custodyId {
+		t.Fatalf("expired parcels: %v", report.Expired)
+	}
+	expectReturned("expirePendingTransfers")
+}
+
+func TestConsignmentTransfersCheckEveryParcel(t *testing.T) {
+	var consignment Consignment
+
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+
+	stub.register(t, admin, operator)
+	custodyId := stub.newChain(t, member, "T1")
+	payload := stub.mustInvoke(t, member, "createConsignment")
+	json.Unmarshal(payload, &consignment)
+	consignmentId := consignment.Id
+	stub.mustInvoke(t, member, "addToConsignment", consignmentId, `["`+custodyId+`"]`)
+
+	stub.mustInvoke(t, admin, "setConfig", `{"permissions":[{"operation":"startTransfer","roles":["`+CALLER_ROLE_1+`"]}]}`)
+	stub.expectError(t, ERR_FORBIDDEN, member, "startConsignmentTransfer", consignmentId, "op1")
+	stub.mustInvoke(t, admin, "setConfig", `{"permissions":[]}`)
+	stub.mustInvoke(t, member, "startConsignmentTransfer", consignmentId, "op1")
+	stub.mustInvoke(t, admin, "setConfig", `{"permissions":[{"operation":"completeTrasfer","roles":["`+CALLER_ROLE_2+`"],"statuses":["`+IN_CUSTODY+`"]}]}`)
+	stub.expectError(t, ERR_FORBIDDEN, operator, "completeConsignmentTransfer", consignmentId)
+	if chainOfCustody := stub.getChain(t, custodyId); chainOfCustody.Status != TRANSFER_PENDING {
+		t.Fatalf("parcel moved against the completeTrasfer rows: %s", chainOfCustody.Status)
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//GRANTDELEGATION: args are the delegate, the RFC3339 start of the window (empty for the transaction time),
+//its RFC3339 end and optionally the delegator. From the start to the end of the window the delegate
+//acts as custodian and receiver of the parcels of the delegator, see actsFor.
+//The delegator is the caller unless he has the 'manageDelegations' permission (Admin),
+//without it the caller must be the custodian of an open parcel, see isActingCustodian.
+//The window can't be longer than the MaxDelegationHours of the ChaincodeConfig.
+//Granting again to the same delegate replaces the window.
+
+func (t *DcotWorkflowChaincode) grantDelegation(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("grantDelegation()")
+
+	var err error
+	var callerRole, callerUID string
+	var delegation Delegation
+	var delegationKey string
+	var delegationBytes []byte
+	var txTime, validFrom, validUntil time.Time
+	var participant *Participant
+	var config ChaincodeConfig
+	var custodian bool
+
+	if len(args) != 3 && len(args) != 4 {
+		return errorResponse(ERR_BAD_ARGS, "grantDelegation", "this method must want three or four arguments!!")
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("grantDelegation ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("grantDelegation", err)
+	}
+	delegation.Delegator, err = getDelegator(stub, "grantDelegation", callerUID, args, 3)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("grantDelegation", err)
+	}
+	if checkPermissionOn(stub, "manageDelegations", PermissionSubject{}) != nil {
+		custodian, err = isActingCustodian(stub, delegation.Delegator)
+		if err != nil {
+			logger.Error("grantDelegation ERROR: isActingCustodian()\n")
+			return errorResponseFrom("grantDelegation", err)
+		}
+		if !custodian {
+			return errorResponse(ERR_FORBIDDEN, "grantDelegation", "only the custodian of a parcel can grant a delegation!!")
+		}
+	}
+	delegation.Delegate = resolveIdentity(callerUID, args[0])
+	if len(delegation.Delegate) == 0 || delegation.Delegate == delegation.Delegator {
+		return errorResponse(ERR_BAD_ARGS, "grantDelegation", "the delegate must be another identity!!")
+	}
+	participant, err = getParticipant(stub, delegation.Delegate)
+	if err != nil {
+		logger.Error("grantDelegation ERROR: getParticipant()\n")
+		return errorResponseFrom("grantDelegation", err)
+	}
+	if participant == nil || !participant.Active {
+		return errorResponse(ERR_BAD_ARGS, "grantDelegation", "the delegate "+delegation.Delegate+" is not an active participant!!")
+	}
+	txTime, err = getTxTime(stub)
+	if err != nil {
+		logger.Error("grantDelegation ERROR: getTxTime()\n")
+		return errorResponseFrom("grantDelegation", err)
+	}
+	validFrom = txTime
+	if len(args[1]) != 0 {
+		validFrom, err = time.Parse(time.RFC3339, args[1])
+		if err != nil {
+			return errorResponse(ERR_BAD_ARGS, "grantDelegation", "the start of the window must be a RFC3339 time!!")
+		}
+	}
+	if len(args[2]) == 0 {
+		return errorResponse(ERR_BAD_ARGS, "grantDelegation", "the window must have an end!!")
+	}
+	validUntil, err = time.Parse(time.RFC3339, args[2])
+	if err != nil {
+		return errorResponse(ERR_BAD_ARGS, "grantDelegation", "the end of the window must be a RFC3339 time!!")
+	}
+	if !validUntil.After(validFrom) || !validUntil.After(txTime) {
+		return errorResponse(ERR_BAD_ARGS, "grantDelegation", "the end of the window must follow its start and the transaction time!!")
+	}
+	config, err = getConfig(stub)
+	if err != nil {
+		logger.Error("grantDelegation ERROR: getConfig()\n")
+		return errorResponseFrom("grantDelegation", err)
+	}
+	if validUntil.Sub(validFrom) > time.Duration(config.MaxDelegationHours)*time.Hour {
+		return errorResponse(ERR_BAD_ARGS, "grantDelegation", "the window can't be longer than "+strconv.Itoa(config.MaxDelegationHours)+" hours!!")
+	}
+	delegation.ValidFrom = validFrom.UTC().Format(time.RFC3339)
+	delegation.ValidUntil = validUntil.UTC().Format(time.RFC3339)
+
+	delegationKey, err = getDelegationKey(stub, delegation.Delegator, delegation.Delegate)
+	if err != nil {
+		return errorResponse(ERR_BAD_ARGS, "grantDelegation", err.Error())
+	}
+	delegationBytes, err = storeDelegation(stub, delegationKey, &delegation, "grantDelegation", callerUID, callerRole)
+	if err != nil {
+		logger.Error("grantDelegation ERROR: storeDelegation()\n")
+		return errorResponseFrom("grantDelegation", err)
+	}
+	return shim.Success(delegationBytes)
+}
+
+//REVOKEDELEGATION: args are the delegate and optionally the delegator, like in grantDelegation.
+//The delegation stays in the ledger with Revoked set.
+
+func (t *DcotWorkflowChaincode) revokeDelegation(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("revokeDelegation()")
+
+	var err error
+	var callerRole, callerUID string
+	var delegator, delegate string
+	var delegation *Delegation
+	var delegationKey string
+	var delegationBytes []byte
+
+	if len(args) != 1 && len(args) != 2 {
+		return errorResponse(ERR_BAD_ARGS, "revokeDelegation", "this method must want one or two arguments!!")
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("revokeDelegation ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("revokeDelegation", err)
+	}
+	delegator, err = getDelegator(stub, "revokeDelegation", callerUID, args, 1)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("revokeDelegation", err)
+	}
+	delegate = resolveIdentity(callerUID, args[0])
+	delegationKey, delegation, err = getDelegation(stub, delegator, delegate)
+	if err != nil {
+		logger.Error("revokeDelegation ERROR: getDelegation()\n")
+		return errorResponseFrom("revokeDelegation", err)
+	}
+	if delegation == nil {
+		return errorResponse(ERR_NOT_FOUND, "revokeDelegation", "there is no delegation from "+delegator+" to "+delegate+"!!")
+	}
+	if delegation.Revoked {
+		return errorResponse(ERR_INVALID_STATE, "revokeDelegation", "the delegation is already revoked!!")
+	}
+	delegation.Revoked = true
+	delegationBytes, err = storeDelegation(stub, delegationKey, delegation, "revokeDelegation", callerUID, callerRole)
+	if err != nil {
+		logger.Error("revokeDelegation ERROR: storeDelegation()\n")
+		return errorResponseFrom("revokeDelegation", err)
+	}
+	return shim.Success(delegationBytes)
+}
+
+//GETDELEGATIONS: args is optionally the delegator, like in grantDelegation,
+//returns every delegation he granted, the revoked and expired ones included
+
+func (t *DcotWorkflowChaincode) getDelegations(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("getDelegations()")
+
+	var err error
+	var callerUID, delegator string
+	var jsonResp []byte
+
+	delegations := []Delegation{}
+
+	if len(args) > 1 {
+		return errorResponse(ERR_BAD_ARGS, "getDelegations", "this method wants at most one argument!!")
+	}
+	_, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("getDelegations ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("getDelegations", err)
+	}
+	delegator, err = getDelegator(stub, "getDelegations", callerUID, args, 0)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("getDelegations", err)
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(DELEGATION_KEY, []string{delegator})
+	if err != nil {
+		logger.Error("getDelegations ERROR: GetStateByPartialCompositeKey()\n")
+		return errorResponse(ERR_LEDGER, "getDelegations", err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		var delegation Delegation
+
+		delegationResult, err := resultsIterator.Next()
+		if err != nil {
+			logger.Error("getDelegations ERROR: resultsIterator.Next()\n")
+			return errorResponse(ERR_LEDGER, "getDelegations", err.Error())
+		}
+		err = json.Unmarshal(delegationResult.Value, &delegation)
+		if err != nil {
+			logger.Error("getDelegations ERROR: json.Unmarshal()\n")
+			return errorResponse(ERR_CORRUPT_RECORD, "getDelegations", err.Error())
+		}
+		delegations = append(delegations, delegation)
+	}
+	jsonResp, err = json.Marshal(delegations)
+	if err != nil {
+		logger.Error("getDelegations ERROR: json.Marshal()\n")
+		return errorResponseFrom("getDelegations", err)
+	}
+	logger.Debug("Query Response:\n" + string(jsonResp))
+	return shim.Success(jsonResp)
+}
+
+//GETDELEGATOR: the delegator is args[index] if present, otherwise the caller.
+//Only who has the 'manageDelegations' permission can name another delegator.
+
+func getDelegator(stub shim.ChaincodeStubInterface, operation string, callerUID string, args []string, index int) (string, error) {
+
+	if len(args) <= index || len(args[index]) == 0 {
+		if len(callerUID) == 0 {
+			return "", newError(ERR_FORBIDDEN, operation, "the caller has no UID!!")
+		}
+		return callerUID, nil
+	}
+	delegator := resolveIdentity(callerUID, args[index])
+	if delegator == callerUID {
+		return delegator, nil
+	}
+	err := checkPermissionOn(stub, "manageDelegations", PermissionSubject{})
+	if err != nil {
+		return "", newError(ERR_FORBIDDEN, operation, "the caller can't manage the delegations of "+delegator+"!!")
+	}
+	err = checkAdminOrg(stub, operation, callerUID, delegator)
+	if err != nil {
+		return "", err
+	}
+	return delegator, nil
+}
+
+//GETDELEGATION: returns a nil Delegation if the delegator never granted one to the delegate
+
+func getDelegation(stub shim.ChaincodeStubInterface, delegator string, delegate string) (string, *Delegation, error) {
+	var delegation Delegation
+
+	delegationKey, err := getDelegationKey(stub, delegator, delegate)
+	if err != nil {
+		return "", nil, newError(ERR_BAD_ARGS, "", err.Error())
+	}
+	err = loadRecord(stub, delegationKey, "Delegation", delegator+" -> "+delegate, &delegation)
+	if err != nil {
+		if chaincodeError, ok := err.(*ErrorResponse); ok && chaincodeError.Code == ERR_NOT_FOUND {
+			return delegationKey, nil, nil
+		}
+		return "", nil, err
+	}
+	return delegationKey, &delegation, nil
+}
+
+func storeDelegation(stub shim.ChaincodeStubInterface, delegationKey string, delegation *Delegation, operation string, callerUID string, callerRole string) ([]byte, error) {
+
+	var err error
+
+	delegation.DocType = DOC_TYPE_DELEGATION
+	delegation.Event, err = createEvent(stub, callerUID, callerRole, operation)
+	if err != nil {
+		return nil, err
+	}
+	delegationBytes, err := json.Marshal(delegation)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.PutState(delegationKey, delegationBytes)
+	if err != nil {
+		return nil, newError(ERR_LEDGER, "", err.Error())
+	}
+	err = stub.SetEvent(operation+" EVENT: ", delegationBytes)
+	if err != nil {
+		return nil, newError(ERR_LEDGER, "", err.Error())
+	}
+	logger.Info(operation+" EVENT: ", string(delegationBytes))
+	return delegationBytes, nil
+}
+
+// the statuses of the parcels whose custodian can still grant a delegation
+var openCustodyStatuses = []string{IN_CUSTODY, TRANSFER_PENDING, RETURN_TO_SENDER, RETURN_PENDING, ON_HOLD}
+
+//ISACTINGCUSTODIAN: true if uid is the custodian of at least one parcel not yet delivered, returned or released
+
+func isActingCustodian(stub shim.ChaincodeStubInterface, uid string) (bool, error) {
+
+	for _, status := range openCustodyStatuses {
+		custodyIds, err := getIdsByIndex(stub, DELIVERY_MAN_INDEX, []string{uid, status})
+		if err != nil {
+			return false, err
+		}
+		if len(custodyIds) != 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//ACTSFOR: true if the caller is owner or acts for him under a Delegation
+//not revoked whose window contains the transaction time
+
+func actsFor(stub shim.ChaincodeStubInterface, callerUID string, owner string) (bool, error) {
+
+	if len(callerUID) == 0 || len(owner) == 0 {
+		return false, nil
+	}
+	if callerUID == owner {
+		return true, nil
+	}
+	_, delegation, err := getDelegation(stub, owner, callerUID)
+	if err != nil || delegation == nil || delegation.Revoked {
+		return false, err
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return false, err
+	}
+	validFrom, err := time.Parse(time.RFC3339, delegation.ValidFrom)
+	if err != nil {
+		return false, newError(ERR_CORRUPT_RECORD, "", "the window of the delegation is not a RFC3339 time!!")
+	}
+	validUntil, err := time.Parse(time.RFC3339, delegation.ValidUntil)
+	if err != nil {
+		return false, newError(ERR_CORRUPT_RECORD, "", "the window of the delegation is not a RFC3339 time!!")
+	}
+	return !txTime.Before(validFrom) && txTime.Before(validUntil), nil
+}
+
+//DELEGATOROF: the custodian or the pending custodian of chainOfCustody, as it was before the operation
+//or as it was created, the caller acts for under a Delegation, empty if he acts in his own name
+
+func delegatorOf(stub shim.ChaincodeStubInterface, callerUID string, chainOfCustody *ChainOfCustody) (string, error) {
+
+	if callerUID == chainOfCustody.Custodian || callerUID == chainOfCustody.PendingCustodian {
+		return "", nil
+	}
+	for _, owner := range []string{chainOfCustody.Custodian, chainOfCustody.PendingCustodian} {
+		delegated, err := actsFor(stub, callerUID, owner)
+		if err != nil {
+			return "", err
+		}
+		if delegated {
+			return owner, nil
+		}
+	}
+	return "", nil
+}
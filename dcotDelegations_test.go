@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelegationWindow(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	delegator := newOfficeCaller("d1", CALLER_ROLE_3, "RM01")
+	delegate := newOfficeCaller("d2", CALLER_ROLE_3, "RM01")
+	receiver := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+
+	stub.register(t, admin, delegator)
+	stub.register(t, admin, delegate)
+	stub.register(t, admin, receiver)
+	custodyId := stub.newChain(t, member, "T1")
+	stub.mustInvoke(t, member, "startTransfer", custodyId, "d1")
+
+	validFrom := stub.now.Add(time.Minute)
+	validUntil := stub.now.Add(time.Hour)
+	//d1 is only the receiver of T1
+	stub.expectError(t, ERR_FORBIDDEN, delegator, "grantDelegation", "d2", validFrom.Format(time.RFC3339), validUntil.Format(time.RFC3339))
+	heldId := stub.newChain(t, member, "T2")
+	stub.mustInvoke(t, member, "startTransfer", heldId, "d1")
+	stub.mustInvoke(t, delegator, "completeTrasfer", heldId)
+
+	stub.expectError(t, ERR_BAD_ARGS, delegator, "grantDelegation", "d2", "", "")
+	stub.expectError(t, ERR_BAD_ARGS, delegator, "grantDelegation", "d2", "", stub.now.Add(DEFAULT_MAX_DELEGATION_HOURS*time.Hour+time.Minute).Format(time.RFC3339))
+	stub.expectError(t, ERR_BAD_ARGS, delegator, "grantDelegation", "d1", "", validUntil.Format(time.RFC3339))
+	stub.expectError(t, ERR_BAD_ARGS, delegator, "grantDelegation", "nobody", "", validUntil.Format(time.RFC3339))
+	stub.expectError(t, ERR_BAD_ARGS, delegator, "grantDelegation", "d2", "", stub.now.Add(-time.Minute).Format(time.RFC3339))
+	stub.expectError(t, ERR_FORBIDDEN, member, "grantDelegation", "d2", "", validUntil.Format(time.RFC3339), "d1")
+	stub.mustInvoke(t, delegator, "grantDelegation", "d2", validFrom.Format(time.RFC3339), validUntil.Format(time.RFC3339))
+
+	//before the window
+	stub.expectError(t, ERR_FORBIDDEN, delegate, "completeTrasfer", custodyId)
+
+	//inside the window the parcel goes to the delegator
+	stub.now = validFrom
+	stub.mustInvoke(t, delegate, "completeTrasfer", custodyId)
+	chainOfCustody := stub.getChain(t, custodyId)
+	if chainOfCustody.Custodian != delegator.identity() {
+		t.Fatalf("custodian after the delegated completeTrasfer: %s", chainOfCustody.Custodian)
+	}
+	if chainOfCustody.Event.Caller != delegate.identity() || chainOfCustody.Event.OnBehalfOf != delegator.identity() {
+		t.Fatalf("event of the delegated completeTrasfer: caller %s, on behalf of %s", chainOfCustody.Event.Caller, chainOfCustody.Event.OnBehalfOf)
+	}
+	//the delegation is not transitive
+	stub.expectError(t, ERR_FORBIDDEN, delegate, "grantDelegation", "op1", "", validUntil.Format(time.RFC3339))
+	stub.mustInvoke(t, admin, "grantDelegation", "op1", "", validUntil.Format(time.RFC3339), "d2")
+	stub.expectError(t, ERR_FORBIDDEN, receiver, "startTransfer", custodyId, "d2")
+
+	//after the window
+	stub.now = validUntil
+	stub.expectError(t, ERR_FORBIDDEN, delegate, "startTransfer", custodyId, "op1")
+
+	//revoked
+	stub.mustInvoke(t, delegator, "grantDelegation", "d2", "", stub.now.Add(time.Hour).Format(time.RFC3339))
+	stub.mustInvoke(t, admin, "revokeDelegation", "d2", "d1")
+	stub.expectError(t, ERR_FORBIDDEN, delegate, "startTransfer", custodyId, "op1")
+	stub.expectError(t, ERR_INVALID_STATE, delegator, "revokeDelegation", "d2")
+
+	stub.mustInvoke(t, delegator, "startTransfer", custodyId, "op1")
+	if event := stub.getChain(t, custodyId).Event; len(event.OnBehalfOf) != 0 {
+		t.Fatalf("the custodian acting for himself is marked on behalf of %s", event.OnBehalfOf)
+	}
+}
+
+func TestDelegationWindowHasAConfiguredMaximum(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	delegate := newOfficeCaller("d2", CALLER_ROLE_3, "RM01")
+
+	stub.register(t, admin, delegate)
+	stub.newChain(t, member, "T1")
+	stub.expectError(t, ERR_BAD_ARGS, admin, "setConfig", `{"maxDelegationHours":-1}`)
+	stub.mustInvoke(t, admin, "setConfig", `{"maxDelegationHours":8}`)
+	stub.expectError(t, ERR_BAD_ARGS, member, "grantDelegation", "d2", "", stub.now.Add(9*time.Hour).Format(time.RFC3339))
+	stub.mustInvoke(t, member, "grantDelegation", "d2", "", stub.now.Add(8*time.Hour).Format(time.RFC3339))
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// the OTP and its salt are passed in the transient data so that the OTP is never written in the ledger,
+// the salted hash is stored apart from the ChainOfCustody and no function returns it
+const (
+	OTP_TRANSIENT_KEY      = "otp"
+	OTP_SALT_TRANSIENT_KEY = "otpSalt"
+	OTP_MIN_LENGTH         = 8
+	OTP_SALT_MIN_LENGTH    = 16
+	OTP_ITERATIONS         = 10000
+)
+
+var sha256Pattern = regexp.MustCompile("^[0-9a-f]{64}$")
+
+var attemptReasons = []string{ATTEMPT_RECIPIENT_ABSENT, ATTEMPT_WRONG_ADDRESS, ATTEMPT_REFUSED, ATTEMPT_ACCESS_DENIED, ATTEMPT_OTHER}
+
+//DELIVERPARCEL: args are the custody id and the json of the ProofOfDelivery with the recipient name,
+//the hex sha256 of the signature image or photo and the optional GPS coordinates.
+//If an OTP was set by initNewChain the same OTP must be in the transient data under the 'otp' key.
+//ChainOfCustody must have 'IN_CUSTODY' status, the caller must be the current custodian
+//and a DELIVERY_OPERATOR, the ChainOfCustody becomes 'DELIVERED'!!
+
+func (t *DcotWorkflowChaincode) deliverParcel(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("deliverParcel()")
+
+	var err error
+	var callerRole, callerUID string
+	var COCKey string
+	var chainOfCustody *ChainOfCustody
+	var previous ChainOfCustody
+	var proofOfDelivery ProofOfDelivery
+	var otp string
+	var deliveryOtp *DeliveryOtp
+	var byteCOC []byte
+
+	operation := "deliverParcel"
+
+	if len(args) != 2 {
+		return errorResponse(ERR_BAD_ARGS, "deliverParcel", "this method must want exactly two arguments!!")
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("deliverParcel ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("deliverParcel", err)
+	}
+	COCKey, chainOfCustody, previous, err = loadChainOfCustody(stub, args[0])
+	if err != nil {
+		logger.Error("deliverParcel ERROR: loadChainOfCustody()\n")
+		return errorResponseFrom("deliverParcel", err)
+	}
+	err = checkConsignment(chainOfCustody, operation, "")
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("deliverParcel", err)
+	}
+	chainOfCustody.Status, err = applyTransition(operation, chainOfCustody.Status)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("deliverParcel", err)
+	}
+	err = json.Unmarshal([]byte(args[1]), &proofOfDelivery)
+	if err != nil {
+		logger.Error("deliverParcel ERROR: json.Unmarshal()\n")
+		return errorResponse(ERR_BAD_ARGS, "deliverParcel", err.Error())
+	}
+	err = checkProofOfDelivery(&proofOfDelivery)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("deliverParcel", err)
+	}
+	otp, err = getTransientOtp(stub)
+	if err != nil {
+		logger.Error("deliverParcel ERROR: GetTransient()\n")
+		return errorResponseFrom("deliverParcel", err)
+	}
+	deliveryOtp, err = loadDeliveryOtp(stub, chainOfCustody)
+	if err != nil {
+		logger.Error("deliverParcel ERROR: loadDeliveryOtp()\n")
+		return errorResponseFrom("deliverParcel", err)
+	}
+	if deliveryOtp != nil {
+		if len(otp) == 0 {
+			logger.Error("deliverParcel ERROR : the OTP is required for this parcel!!\n")
+			return errorResponse(ERR_BAD_ARGS, "deliverParcel", "the OTP is required for this parcel!!")
+		}
+		if subtle.ConstantTimeCompare([]byte(hashOtp(deliveryOtp.Salt, otp, deliveryOtp.Iterations)), []byte(deliveryOtp.Hash)) != 1 {
+			logger.Error("deliverParcel ERROR : the OTP is not valid!!\n")
+			return errorResponse(ERR_FORBIDDEN, "deliverParcel", "the OTP is not valid!!")
+		}
+		proofOfDelivery.OtpVerified = true
+	} else if len(otp) != 0 {
+		logger.Error("deliverParcel ERROR : no OTP was set for this parcel!!\n")
+		return errorResponse(ERR_BAD_ARGS, "deliverParcel", "no OTP was set for this parcel!!")
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return errorResponseFrom("deliverParcel", err)
+	}
+	proofOfDelivery.DeliveredBy = callerUID
+	proofOfDelivery.Moment = txTime.UTC().Format(time.RFC3339)
+	chainOfCustody.ProofOfDelivery = &proofOfDelivery
+
+	byteCOC, err = storeChainOfCustody(stub, COCKey, &previous, chainOfCustody, operation, callerUID, callerRole, args)
+	if err != nil {
+		logger.Error("deliverParcel ERROR: storeChainOfCustody()\n")
+		return errorResponseFrom("deliverParcel", err)
+	}
+	err = stub.SetEvent("deliverParcel EVENT: ", byteCOC)
+	if err != nil {
+		logger.Error("deliverParcel ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, "deliverParcel", err.Error())
+	}
+	logger.Info("deliverParcel EVENT: ", string(byteCOC))
+	return shim.Success(byteCOC)
+}
+
+//RECORDDELIVERYATTEMPT: args are the custody id and the json of the DeliveryAttempt with the reason code,
+//an optional note and the optional GPS coordinates, the moment is the transaction timestamp.
+//When the attempts reach the configured maximum the ChainOfCustody goes to 'RETURN_TO_SENDER'.
+//ChainOfCustody must have 'IN_CUSTODY' status, the caller must be the current custodian
+//and a DELIVERY_OPERATOR!!
+
+func (t *DcotWorkflowChaincode) recordDeliveryAttempt(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("recordDeliveryAttempt()")
+
+	var err error
+	var callerRole, callerUID string
+	var COCKey string
+	var chainOfCustody *ChainOfCustody
+	var previous ChainOfCustody
+	var attempt DeliveryAttempt
+	var config ChaincodeConfig
+	var byteCOC []byte
+
+	operation := "recordDeliveryAttempt"
+
+	if len(args) != 2 {
+		return errorResponse(ERR_BAD_ARGS, "recordDeliveryAttempt", "this method must want exactly two arguments!!")
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("recordDeliveryAttempt ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("recordDeliveryAttempt", err)
+	}
+	COCKey, chainOfCustody, previous, err = loadChainOfCustody(stub, args[0])
+	if err != nil {
+		logger.Error("recordDeliveryAttempt ERROR: loadChainOfCustody()\n")
+		return errorResponseFrom("recordDeliveryAttempt", err)
+	}
+	err = checkConsignment(chainOfCustody, operation, "")
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("recordDeliveryAttempt", err)
+	}
+	chainOfCustody.Status, err = applyTransition(operation, chainOfCustody.Status)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("recordDeliveryAttempt", err)
+	}
+	err = json.Unmarshal([]byte(args[1]), &attempt)
+	if err != nil {
+		logger.Error("recordDeliveryAttempt ERROR: json.Unmarshal()\n")
+		return errorResponse(ERR_BAD_ARGS, "recordDeliveryAttempt", err.Error())
+	}
+	if !containsString(attemptReasons, attempt.Reason) {
+		logger.Error("recordDeliveryAttempt ERROR : unknown reason code " + attempt.Reason + "!!\n")
+		return errorResponse(ERR_BAD_ARGS, "recordDeliveryAttempt", "unknown reason code "+attempt.Reason+"!!")
+	}
+	err = checkCoordinates(operation, attempt.Latitude, attempt.Longitude)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("recordDeliveryAttempt", err)
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return errorResponseFrom("recordDeliveryAttempt", err)
+	}
+	attempt.AttemptedBy = callerUID
+	attempt.Moment = txTime.UTC().Format(time.RFC3339)
+	chainOfCustody.DeliveryAttempts = append(chainOfCustody.DeliveryAttempts, attempt)
+
+	config, err = getConfig(stub)
+	if err != nil {
+		logger.Error("recordDeliveryAttempt ERROR: getConfig()\n")
+		return errorResponseFrom("recordDeliveryAttempt", err)
+	}
+	if len(chainOfCustody.DeliveryAttempts) >= config.MaxDeliveryAttempts {
+		operation = "returnToSender"
+		chainOfCustody.Status, err = applyTransition(operation, chainOfCustody.Status)
+		if err != nil {
+			logger.Error(err.Error())
+			return errorResponseFrom("recordDeliveryAttempt", err)
+		}
+	}
+	byteCOC, err = storeChainOfCustody(stub, COCKey, &previous, chainOfCustody, operation, callerUID, callerRole, args)
+	if err != nil {
+		logger.Error("recordDeliveryAttempt ERROR: storeChainOfCustody()\n")
+		return errorResponseFrom("recordDeliveryAttempt", err)
+	}
+	err = stub.SetEvent(operation+" EVENT: ", byteCOC)
+	if err != nil {
+		logger.Error("recordDeliveryAttempt ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, "recordDeliveryAttempt", err.Error())
+	}
+	logger.Info(operation+" EVENT: ", string(byteCOC))
+	return shim.Success(byteCOC)
+}
+
+//COMPLETERETURN: the parcel is back at the office of the CodeOwner and leaves the custody chain.
+//ChainOfCustody must have 'RETURN_TO_SENDER' status, the caller must be the current custodian,
+//a OPERATOR/ADMIN registered in the same office of the CodeOwner!!
+
+func (t *DcotWorkflowChaincode) completeReturn(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("completeReturn()")
+
+	var err error
+	var callerRole, callerUID string
+	var COCKey string
+	var chainOfCustody *ChainOfCustody
+	var previous ChainOfCustody
+	var owner, caller *Participant
+	var byteCOC []byte
+
+	operation := "completeReturn"
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, "completeReturn", "this method must want exactly one argument!!")
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("completeReturn ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("completeReturn", err)
+	}
+	COCKey, chainOfCustody, previous, err = loadChainOfCustody(stub, args[0])
+	if err != nil {
+		logger.Error("completeReturn ERROR: loadChainOfCustody()\n")
+		return errorResponseFrom("completeReturn", err)
+	}
+	chainOfCustody.Status, err = applyTransition(operation, chainOfCustody.Status)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("completeReturn", err)
+	}
+	//a bare UID is a participant of the organization owning the parcel, like the identities passed as arguments
+	codeOwner := chainOfCustody.CodeOwner
+	if len(identityOrg(codeOwner)) == 0 {
+		ownerOrg := chainOfCustody.OwnerOrg
+		if len(ownerOrg) == 0 {
+			ownerOrg = identityOrg(callerUID)
+		}
+		codeOwner = qualifiedIdentity(ownerOrg, codeOwner)
+	}
+	owner, err = getParticipant(stub, codeOwner)
+	if err != nil {
+		logger.Error("completeReturn ERROR: getParticipant()\n")
+		return errorResponseFrom("completeReturn", err)
+	}
+	if owner == nil || len(owner.Office) == 0 {
+		logger.Error("completeReturn ERROR : the office of the CodeOwner is unknown!!\n")
+		return errorResponse(ERR_INVALID_STATE, "completeReturn", "the office of the CodeOwner is unknown!!")
+	}
+	caller, err = getParticipant(stub, callerUID)
+	if err != nil {
+		logger.Error("completeReturn ERROR: getParticipant()\n")
+		return errorResponseFrom("completeReturn", err)
+	}
+	if caller == nil || caller.Office != owner.Office {
+		logger.Error("completeReturn ERROR : the caller is not in the office of the CodeOwner!!\n")
+		return errorResponse(ERR_FORBIDDEN, "completeReturn", "the caller is not in the office of the CodeOwner!!")
+	}
+	byteCOC, err = storeChainOfCustody(stub, COCKey, &previous, chainOfCustody, operation, callerUID, callerRole, args)
+	if err != nil {
+		logger.Error("completeReturn ERROR: storeChainOfCustody()\n")
+		return errorResponseFrom("completeReturn", err)
+	}
+	err = stub.SetEvent("completeReturn EVENT: ", byteCOC)
+	if err != nil {
+		logger.Error("completeReturn ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, "completeReturn", err.Error())
+	}
+	logger.Info("completeReturn EVENT: ", string(byteCOC))
+	return shim.Success(byteCOC)
+}
+
+func checkProofOfDelivery(proofOfDelivery *ProofOfDelivery) error {
+	if len(proofOfDelivery.RecipientName) == 0 {
+		return newError(ERR_BAD_ARGS, "deliverParcel", "the recipient name must not be empty!!")
+	}
+	if !sha256Pattern.MatchString(proofOfDelivery.SignatureHash) {
+		return newError(ERR_BAD_ARGS, "deliverParcel", "the signature hash must be a lowercase hex sha256!!")
+	}
+	proofOfDelivery.OtpVerified = false
+	return checkCoordinates("deliverParcel", proofOfDelivery.Latitude, proofOfDelivery.Longitude)
+}
+
+//CHECKCOORDINATES: GPS coordinates are optional but latitude and longitude go together
+
+func checkCoordinates(operation string, latitude *float64, longitude *float64) error {
+	if (latitude == nil) != (longitude == nil) {
+		return newError(ERR_BAD_ARGS, operation, "latitude and longitude must be set together!!")
+	}
+	if latitude != nil && (*latitude < -90 || *latitude > 90) {
+		return newError(ERR_BAD_ARGS, operation, "latitude out of range!!")
+	}
+	if longitude != nil && (*longitude < -180 || *longitude > 180) {
+		return newError(ERR_BAD_ARGS, operation, "longitude out of range!!")
+	}
+	return nil
+}
+
+//SETDELIVERYOTP: clears the fields of the delivery of a new ChainOfCustody, they are never taken from the client's json,
+//and with an OTP stores its hash with getOtpKey. The OTP must have at least OTP_MIN_LENGTH characters
+//and the client must supply a random salt of at least OTP_SALT_MIN_LENGTH bytes under the 'otpSalt' transient key,
+//a salt derived from the transaction would be known before the OTP is set.
+
+func setDeliveryOtp(stub shim.ChaincodeStubInterface, chainOfCustody *ChainOfCustody, otp string) error {
+
+	chainOfCustody.OtpRequired = false
+	chainOfCustody.OtpSalt = ""
+	chainOfCustody.OtpHash = ""
+	chainOfCustody.ProofOfDelivery = nil
+	chainOfCustody.DeliveryAttempts = nil
+	if len(otp) == 0 {
+		return nil
+	}
+	if len(otp) < OTP_MIN_LENGTH {
+		return newError(ERR_BAD_ARGS, "", "the OTP must have at least "+strconv.Itoa(OTP_MIN_LENGTH)+" characters!!")
+	}
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return err
+	}
+	salt := transient[OTP_SALT_TRANSIENT_KEY]
+	if len(salt) < OTP_SALT_MIN_LENGTH {
+		return newError(ERR_BAD_ARGS, "", "the transient data must contain a random "+OTP_SALT_TRANSIENT_KEY+" of at least "+strconv.Itoa(OTP_SALT_MIN_LENGTH)+" bytes!!")
+	}
+	deliveryOtp := DeliveryOtp{Salt: hex.EncodeToString(salt), Iterations: OTP_ITERATIONS}
+	deliveryOtp.Hash = hashOtp(deliveryOtp.Salt, otp, deliveryOtp.Iterations)
+	err = putDeliveryOtp(stub, chainOfCustody.Id, &deliveryOtp)
+	if err != nil {
+		return err
+	}
+	chainOfCustody.OtpRequired = true
+	return nil
+}
+
+//LOADDELIVERYOTP: nil if the ChainOfCustody doesn't require an OTP
+
+func loadDeliveryOtp(stub shim.ChaincodeStubInterface, chainOfCustody *ChainOfCustody) (*DeliveryOtp, error) {
+
+	var deliveryOtp DeliveryOtp
+
+	if chainOfCustody.legacyOtp != nil {
+		return chainOfCustody.legacyOtp, nil
+	}
+	if !chainOfCustody.OtpRequired {
+		return nil, nil
+	}
+	otpKey, err := getOtpKey(stub, chainOfCustody.Id)
+	if err != nil {
+		return nil, err
+	}
+	err = loadRecord(stub, otpKey, "the OTP of", chainOfCustody.Id, &deliveryOtp)
+	if err != nil {
+		return nil, err
+	}
+	return &deliveryOtp, nil
+}
+
+func putDeliveryOtp(stub shim.ChaincodeStubInterface, custodyId string, deliveryOtp *DeliveryOtp) error {
+
+	otpKey, err := getOtpKey(stub, custodyId)
+	if err != nil {
+		return err
+	}
+	deliveryOtp.DocType = DOC_TYPE_DELIVERY_OTP
+	otpBytes, err := json.Marshal(deliveryOtp)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(otpKey, otpBytes)
+	if err != nil {
+		return newError(ERR_LEDGER, "", err.Error())
+	}
+	return nil
+}
+
+//STORELEGACYOTP: moves the OTP of a legacy record to its own key,
+//every ChainOfCustody read by loadChainOfCustody is written by storeChainOfCustody, which calls it
+
+func storeLegacyOtp(stub shim.ChaincodeStubInterface, chainOfCustody *ChainOfCustody) error {
+
+	if chainOfCustody.legacyOtp == nil {
+		return nil
+	}
+	err := putDeliveryOtp(stub, chainOfCustody.Id, chainOfCustody.legacyOtp)
+	if err != nil {
+		return err
+	}
+	chainOfCustody.legacyOtp = nil
+	return nil
+}
+
+//COPYDELIVERYOTP: the ChainOfCustody created by splitChain or mergeChains requires the OTP of source
+
+func copyDeliveryOtp(stub shim.ChaincodeStubInterface, source *ChainOfCustody, target *ChainOfCustody) error {
+
+	target.OtpRequired = false
+	deliveryOtp, err := loadDeliveryOtp(stub, source)
+	if err != nil || deliveryOtp == nil {
+		return err
+	}
+	err = putDeliveryOtp(stub, target.Id, deliveryOtp)
+	if err != nil {
+		return err
+	}
+	target.OtpRequired = true
+	return nil
+}
+
+//HASHOTP: PBKDF2 with HMAC-SHA256, iterations 0 is the single sha256 of the legacy records
+
+func hashOtp(salt string, otp string, iterations int) string {
+
+	if iterations == 0 {
+		hash := sha256.Sum256([]byte(salt + otp))
+		return hex.EncodeToString(hash[:])
+	}
+	mac := hmac.New(sha256.New, []byte(otp))
+	mac.Write([]byte(salt))
+	mac.Write([]byte{0, 0, 0, 1})
+	block := mac.Sum(nil)
+	key := append([]byte{}, block...)
+	for round := 1; round < iterations; round++ {
+		mac.Reset()
+		mac.Write(block)
+		block = mac.Sum(block[:0])
+		for index := range key {
+			key[index] ^= block[index]
+		}
+	}
+	return hex.EncodeToString(key)
+}
+
+func getTransientOtp(stub shim.ChaincodeStubInterface) (string, error) {
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return "", err
+	}
+	return string(transient[OTP_TRANSIENT_KEY]), nil
+}
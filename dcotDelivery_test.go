@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestHashOtpIsPbkdf2(t *testing.T) {
+	expected := "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"
+	if hash := hashOtp("salt", "password", 4096); hash != expected {
+		t.Fatalf("PBKDF2-HMAC-SHA256: got %s", hash)
+	}
+}
+
+func TestDeliveryOtpIsNeverReturned(t *testing.T) {
+	var lineage Lineage
+
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+	delivery := newOfficeCaller("d1", CALLER_ROLE_3, "RM01")
+	newChain := `{"trackingId":"T1","documentId":"D1","weightOfParcel":2,"sortingCenterDestination":"SC1","distributionOfficeCode":"RM01"}`
+	salt := []byte("0123456789abcdef")
+	proofOfDelivery := `{"recipientName":"Mario Rossi","signatureHash":"` + sha256Hex("signature") + `"}`
+
+	stub.register(t, admin, operator)
+	stub.register(t, admin, delivery)
+	stub.transient = map[string][]byte{OTP_TRANSIENT_KEY: []byte("1234567")}
+	stub.expectError(t, ERR_BAD_ARGS, member, "initNewChain", newChain)
+	stub.transient = map[string][]byte{OTP_TRANSIENT_KEY: []byte("12345678"), OTP_SALT_TRANSIENT_KEY: []byte("short")}
+	stub.expectError(t, ERR_BAD_ARGS, member, "initNewChain", newChain)
+	stub.transient = map[string][]byte{OTP_TRANSIENT_KEY: []byte("12345678"), OTP_SALT_TRANSIENT_KEY: salt}
+	payload := stub.mustInvoke(t, member, "initNewChain", newChain)
+	var chainOfCustody ChainOfCustody
+	json.Unmarshal(payload, &chainOfCustody)
+	custodyId := chainOfCustody.Id
+	if !chainOfCustody.OtpRequired || strings.Contains(string(payload), "otpHash") || strings.Contains(string(payload), "otpSalt") {
+		t.Fatalf("initNewChain returned %s", string(payload))
+	}
+
+	stub.mustInvoke(t, member, "startTransfer", custodyId, "op1")
+	stub.mustInvoke(t, operator, "completeTrasfer", custodyId)
+	payload = stub.mustInvoke(t, operator, "splitChain", custodyId, `[{},{}]`)
+	json.Unmarshal(payload, &lineage)
+	childId := lineage.Children[0].Id
+	hash := hashOtp(hex.EncodeToString(salt), "12345678", OTP_ITERATIONS)
+	for _, function := range []string{"getAssetDetails", "getLineage"} {
+		payload = stub.mustInvoke(t, admin, function, custodyId)
+		if strings.Contains(string(payload), "otpHash") || strings.Contains(string(payload), hash) {
+			t.Fatalf("%s returned the OTP hash: %s", function, string(payload))
+		}
+	}
+	if !lineage.Children[0].OtpRequired {
+		t.Fatalf("the child of the split doesn't require the OTP")
+	}
+
+	stub.mustInvoke(t, operator, "startTransfer", childId, "d1")
+	stub.mustInvoke(t, delivery, "completeTrasfer", childId)
+	stub.expectError(t, ERR_BAD_ARGS, delivery, "deliverParcel", childId, proofOfDelivery)
+	stub.transient = map[string][]byte{OTP_TRANSIENT_KEY: []byte("87654321")}
+	stub.expectError(t, ERR_FORBIDDEN, delivery, "deliverParcel", childId, proofOfDelivery)
+	stub.transient = map[string][]byte{OTP_TRANSIENT_KEY: []byte("12345678")}
+	stub.mustInvoke(t, delivery, "deliverParcel", childId, proofOfDelivery)
+	if delivered := stub.getChain(t, childId); delivered.Status != DELIVERED || !delivered.ProofOfDelivery.OtpVerified {
+		t.Fatalf("after deliverParcel: status %s", delivered.Status)
+	}
+}
+
+func TestLegacyOtpIsMovedOutOfTheRecord(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	delivery := newOfficeCaller("d1", CALLER_ROLE_3, "RM01")
+	proofOfDelivery := `{"recipientName":"Mario Rossi","signatureHash":"` + sha256Hex("signature") + `"}`
+
+	stub.register(t, admin, delivery)
+	COCKey := putLegacyChain(stub, delivery.identity())
+
+	payload := stub.mustInvoke(t, delivery, "getAssetDetails", "legacy")
+	if strings.Contains(string(payload), "otpHash") || !strings.Contains(string(payload), `"otpRequired":true`) {
+		t.Fatalf("getAssetDetails of a legacy record: %s", string(payload))
+	}
+	stub.mustInvoke(t, admin, "migrateChains")
+	if stored := string(stub.State[COCKey]); strings.Contains(stored, "otpHash") {
+		t.Fatalf("migrateChains left the hash in the record: %s", stored)
+	}
+	stub.transient = map[string][]byte{OTP_TRANSIENT_KEY: []byte("1234")}
+	stub.mustInvoke(t, delivery, "deliverParcel", "legacy", proofOfDelivery)
+}
+
+func TestLegacyOtpSurvivesTheOriginalHandlers(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	delivery := newOfficeCaller("d1", CALLER_ROLE_3, "RM01")
+	proofOfDelivery := `{"recipientName":"Mario Rossi","signatureHash":"` + sha256Hex("signature") + `"}`
+
+	stub.register(t, admin, delivery)
+	COCKey := putLegacyChain(stub, delivery.identity())
+
+	stub.mustInvoke(t, delivery, "commentChain", "legacy", "left at the sorting center")
+	if stored := string(stub.State[COCKey]); strings.Contains(stored, "otpHash") || !strings.Contains(stored, `"otpRequired":true`) {
+		t.Fatalf("commentChain of a legacy record: %s", stored)
+	}
+	stub.transient = map[string][]byte{OTP_TRANSIENT_KEY: []byte("4321")}
+	stub.expectError(t, ERR_FORBIDDEN, delivery, "deliverParcel", "legacy", proofOfDelivery)
+	stub.transient = map[string][]byte{OTP_TRANSIENT_KEY: []byte("1234")}
+	stub.mustInvoke(t, delivery, "deliverParcel", "legacy", proofOfDelivery)
+}
+
+//PUTLEGACYCHAIN: writes a record of the office RM01 with the OTP hash 1234 in it, returns its key
+
+func putLegacyChain(stub *testStub, custodian string) string {
+	legacy := ChainOfCustody{Id: "legacy", TrackingId: "T1", DocumentId: "D1", WeightOfParcel: 1, DistributionOfficeCode: "RM01", Custodian: custodian, Status: IN_CUSTODY, OtpSalt: "publicsalt", OtpHash: hashOtp("publicsalt", "1234", 0)}
+	legacyBytes, _ := json.Marshal(legacy)
+	COCKey, _ := getCOCKey(stub, "legacy")
+	stub.MockTransactionStart("legacy")
+	stub.PutState(COCKey, legacyBytes)
+	stub.MockTransactionEnd("legacy")
+	return COCKey
+}
+
+func TestCompleteReturnFindsTheOfficeOfTheCodeOwner(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	owner := newOfficeCaller("sender", CALLER_ROLE_0, "RM01")
+	delivery := newOfficeCaller("d1", CALLER_ROLE_3, "RM01")
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+
+	stub.register(t, admin, owner)
+	stub.register(t, admin, delivery)
+	stub.register(t, admin, operator)
+	stub.mustInvoke(t, admin, "setConfig", `{"maxDeliveryAttempts":1}`)
+	payload := stub.mustInvoke(t, member, "initNewChain", `{"trackingId":"T1","documentId":"D1","weightOfParcel":2,"sortingCenterDestination":"SC1","distributionOfficeCode":"RM01","codeOwner":"sender"}`)
+	var chainOfCustody ChainOfCustody
+	json.Unmarshal(payload, &chainOfCustody)
+	custodyId := chainOfCustody.Id
+
+	stub.mustInvoke(t, member, "startTransfer", custodyId, "d1")
+	stub.mustInvoke(t, delivery, "completeTrasfer", custodyId)
+	stub.mustInvoke(t, delivery, "recordDeliveryAttempt", custodyId, `{"reason":"`+ATTEMPT_RECIPIENT_ABSENT+`"}`)
+	if status := stub.getChain(t, custodyId).Status; status != RETURN_TO_SENDER {
+		t.Fatalf("status after the last attempt: %s", status)
+	}
+	stub.mustInvoke(t, delivery, "startTransfer", custodyId, "op1")
+	stub.mustInvoke(t, operator, "completeTrasfer", custodyId)
+	stub.mustInvoke(t, operator, "completeReturn", custodyId)
+	if status := stub.getChain(t, custodyId).Status; status != RETURNED {
+		t.Fatalf("status after completeReturn: %s", status)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//EXPIRYREPORT: the response of expirePendingTransfers, the records that can't be decoded
+//are skipped and listed with their id as Field, the others still expire
+
+type ExpiryReport struct {
+	Expired []string     `json:"expired"`
+	Skipped []FieldError `json:"skipped,omitempty"`
+}
+
+//EXPIREPENDINGTRANSFERS: every ChainOfCustody in 'TRANSFER_PENDING' or 'RETURN_PENDING' status whose deadline
+//is before the transaction timestamp goes back to 'IN_CUSTODY' or 'RETURN_TO_SENDER' with the current custodian.
+//The parcels inside a consignment expire with the consignment, the response lists the custody ids of all of them.
+//Only the entries of the deadline index up to the transaction timestamp are read, see getDeadlineKey.
+//The caller must be a Admin or the Scheduler!!!
+
+func (t *DcotWorkflowChaincode) expirePendingTransfers(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("expirePendingTransfers()")
+
+	var err error
+	var callerRole, callerUID string
+	var txTime time.Time
+	var deadlineKeys []string
+	var byteResp []byte
+
+	report := ExpiryReport{Expired: []string{}}
+
+	if len(args) != 0 {
+		return errorResponse(ERR_BAD_ARGS, "expirePendingTransfers", "this method doesn't want arguments!!")
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("expirePendingTransfers ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("expirePendingTransfers", err)
+	}
+	txTime, err = getTxTime(stub)
+	if err != nil {
+		logger.Error("expirePendingTransfers ERROR: getTxTime()\n")
+		return errorResponseFrom("expirePendingTransfers", err)
+	}
+	deadlineKeys, err = getDueDeadlineKeys(stub, txTime)
+	if err != nil {
+		logger.Error("expirePendingTransfers ERROR: getDueDeadlineKeys()\n")
+		return errorResponseFrom("expirePendingTransfers", err)
+	}
+	for _, deadlineKey := range deadlineKeys {
+		var expiredIds []string
+
+		// the entry is deadline~kind~id
+		keyParts := strings.SplitN(strings.TrimPrefix(deadlineKey, DEADLINE_INDEX), "~", 3)
+		if len(keyParts) != 3 {
+			report.Skipped = append(report.Skipped, FieldError{deadlineKey, "not an entry of the deadline index"})
+			continue
+		}
+		id := keyParts[2]
+		if keyParts[1] == DOC_TYPE_CONSIGNMENT {
+			expiredIds, err = expireConsignmentTransfer(stub, id, txTime, callerUID, callerRole)
+		} else {
+			var expired bool
+
+			expired, err = expireTransfer(stub, id, txTime, callerUID, callerRole)
+			if expired {
+				expiredIds = []string{id}
+			}
+		}
+		if chaincodeError, ok := err.(*ErrorResponse); ok && chaincodeError.Code == ERR_CORRUPT_RECORD {
+			logger.Error("expirePendingTransfers ERROR: " + id + " skipped: " + chaincodeError.Message + "\n")
+			report.Skipped = append(report.Skipped, FieldError{id, chaincodeError.Message})
+			continue
+		}
+		if err != nil {
+			logger.Error("expirePendingTransfers ERROR: expireTransfer() " + id + "\n")
+			return errorResponseFrom("expirePendingTransfers", err)
+		}
+		report.Expired = append(report.Expired, expiredIds...)
+	}
+	byteResp, err = json.Marshal(report)
+	if err != nil {
+		logger.Error("expirePendingTransfers ERROR: json.Marshal()\n")
+		return errorResponseFrom("expirePendingTransfers", err)
+	}
+	err = stub.SetEvent("expirePendingTransfers EVENT: ", byteResp)
+	if err != nil {
+		logger.Error("expirePendingTransfers ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, "expirePendingTransfers", err.Error())
+	}
+	logger.Info("expirePendingTransfers EVENT: ", string(byteResp))
+	return shim.Success(byteResp)
+}
+
+//GETDUEDEADLINEKEYS: the entries of the deadline index up to the second of txTime included,
+//they are read before any write so the range isn't changed while it is scanned
+
+func getDueDeadlineKeys(stub shim.ChaincodeStubInterface, txTime time.Time) ([]string, error) {
+	var deadlineKeys []string
+
+	endKey := DEADLINE_INDEX + txTime.UTC().Truncate(time.Second).Add(time.Second).Format(time.RFC3339)
+	resultsIterator, err := stub.GetStateByRange(DEADLINE_INDEX, endKey)
+	if err != nil {
+		return nil, newError(ERR_LEDGER, "", err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		indexEntry, err := resultsIterator.Next()
+		if err != nil {
+			return nil, newError(ERR_LEDGER, "", err.Error())
+		}
+		deadlineKeys = append(deadlineKeys, indexEntry.Key)
+	}
+	return deadlineKeys, nil
+}
+
+//EXPIRETRANSFER: returns false if the ChainOfCustody has no deadline or it is not expired yet,
+//the parcels inside a consignment are left to expireConsignmentTransfer
+
+func expireTransfer(stub shim.ChaincodeStubInterface, custodyId string, txTime time.Time, callerUID string, callerRole string) (bool, error) {
+
+	operation := "expireTransfer"
+	COCKey, chainOfCustody, previous, err := loadChainOfCustody(stub, custodyId)
+	if err != nil {
+		return false, err
+	}
+	if (chainOfCustody.Status != TRANSFER_PENDING && chainOfCustody.Status != RETURN_PENDING) || len(chainOfCustody.TransferDeadline) == 0 || len(chainOfCustody.ConsignmentId) != 0 {
+		return false, nil
+	}
+	deadline, err := time.Parse(time.RFC3339, chainOfCustody.TransferDeadline)
+	if err != nil {
+		return false, newError(ERR_CORRUPT_RECORD, operation, "the deadline of "+custodyId+" is not a RFC3339 time!!")
+	}
+	if !deadline.Before(txTime) {
+		return false, nil
+	}
+	chainOfCustody.Status, err = applyTransition(operation, chainOfCustody.Status)
+	if err != nil {
+		return false, err
+	}
+	chainOfCustody.PendingCustodian = ""
+	chainOfCustody.TransferDeadline = ""
+	_, err = storeChainOfCustody(stub, COCKey, &previous, chainOfCustody, operation, callerUID, callerRole, []string{custodyId})
+	if err != nil {
+		return false, err
+	}
+	logger.Info("expireTransfer: transfer expired: ", custodyId)
+	return true, nil
+}
+
+//EXPIRECONSIGNMENTTRANSFER: returns the custody ids of the parcels inside the consignment,
+//none if the consignment has no deadline or it is not expired yet
+
+func expireConsignmentTransfer(stub shim.ChaincodeStubInterface, consignmentId string, txTime time.Time, callerUID string, callerRole string) ([]string, error) {
+
+	operation := "expireConsignmentTransfer"
+	consignmentKey, consignment, err := loadConsignment(stub, consignmentId)
+	if err != nil {
+		return nil, err
+	}
+	if consignment.Status != TRANSFER_PENDING || len(consignment.TransferDeadline) == 0 {
+		return nil, nil
+	}
+	deadline, err := time.Parse(time.RFC3339, consignment.TransferDeadline)
+	if err != nil {
+		return nil, newError(ERR_CORRUPT_RECORD, operation, "the deadline of "+consignmentId+" is not a RFC3339 time!!")
+	}
+	if !deadline.Before(txTime) {
+		return nil, nil
+	}
+	_, err = endPendingConsignmentTransfer(stub, consignmentKey, consignment, operation, "expireTransfer", callerUID, callerRole)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("expireConsignmentTransfer: transfer expired: ", consignmentId)
+	return consignment.ParcelIds, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpiryReadsTheDueDeadlinesAndSkipsCorruptRecords(t *testing.T) {
+	var report ExpiryReport
+
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+	scheduler := newCaller("cron", CALLER_ROLE_4)
+
+	stub.register(t, admin, operator)
+	stub.register(t, admin, scheduler)
+	due := stub.newChain(t, member, "T1")
+	later := stub.newChain(t, member, "T2")
+	corrupt := stub.newChain(t, member, "T3")
+	stub.mustInvoke(t, member, "startTransfer", due, "op1", stub.now.Add(time.Hour).Format(time.RFC3339))
+	stub.mustInvoke(t, member, "startTransfer", later, "op1", stub.now.Add(2*time.Hour).Format(time.RFC3339))
+	stub.mustInvoke(t, member, "startTransfer", corrupt, "op1", stub.now.Add(time.Hour).Format(time.RFC3339))
+
+	corruptKey, _ := getCOCKey(stub, corrupt)
+	stub.MockTransactionStart("corrupt")
+	stub.PutState(corruptKey, []byte(`{"id":`))
+	stub.MockTransactionEnd("corrupt")
+
+	stub.now = stub.now.Add(90 * time.Minute)
+	for run, expected := range [][]string{{due}, {}} {
+		report = ExpiryReport{}
+		payload := stub.mustInvoke(t, scheduler, "expirePendingTransfers")
+		json.Unmarshal(payload, &report)
+		if len(report.Skipped) != 1 || report.Skipped[0].Field != corrupt {
+			t.Fatalf("run %d, skipped records: %+v", run, report.Skipped)
+		}
+		if len(report.Expired) != len(expected) || (len(expected) != 0 && report.Expired[0] != expected[0]) {
+			t.Fatalf("run %d, expired parcels: %v", run, report.Expired)
+		}
+	}
+	if chainOfCustody := stub.getChain(t, due); chainOfCustody.Status != IN_CUSTODY || len(chainOfCustody.TransferDeadline) != 0 {
+		t.Fatalf("parcel after its deadline: status %s, deadline %q", chainOfCustody.Status, chainOfCustody.TransferDeadline)
+	}
+	if status := stub.getChain(t, later).Status; status != TRANSFER_PENDING {
+		t.Fatalf("parcel before its deadline: %s", status)
+	}
+	for key := range stub.State {
+		if strings.HasPrefix(key, DEADLINE_INDEX) && strings.HasSuffix(key, due) {
+			t.Fatalf("the deadline index still has %s", key)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// operation raising each exception status
+var exceptionOperations = map[string]string{
+	LOST:    "reportLost",
+	DAMAGED: "reportDamaged",
+	ON_HOLD: "putOnHold",
+}
+
+type ExceptionRequest struct {
+	Status         string   `json:"status"`
+	Reason         string   `json:"reason"`
+	EvidenceHashes []string `json:"evidenceHashes"`
+}
+
+type ResolutionRequest struct {
+	Resolution     string   `json:"resolution"`
+	Note           string   `json:"note"`
+	EvidenceHashes []string `json:"evidenceHashes"`
+}
+
+//RAISEEXCEPTION: args are the custody id and the json with the exception status (LOST, DAMAGED or ON_HOLD),
+//the mandatory reason and the hex sha256 of the evidences.
+//An investigation is opened and the ChainOfCustody can't be transferred until it's resolved,
+//a parcel inside a consignment must be removed from it first.
+//The caller must be a OPERATOR/ADMIN!!
+
+func (t *DcotWorkflowChaincode) raiseException(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("raiseException()")
+
+	var err error
+	var callerRole, callerUID string
+	var COCKey string
+	var chainOfCustody *ChainOfCustody
+	var previous ChainOfCustody
+	var request ExceptionRequest
+	var investigation Investigation
+	var byteCOC []byte
+
+	if len(args) != 2 {
+		return errorResponse(ERR_BAD_ARGS, "raiseException", "this method must want exactly two arguments!!")
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("raiseException ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("raiseException", err)
+	}
+	err = json.Unmarshal([]byte(args[1]), &request)
+	if err != nil {
+		logger.Error("raiseException ERROR: json.Unmarshal()\n")
+		return errorResponse(ERR_BAD_ARGS, "raiseException", err.Error())
+	}
+	operation, found := exceptionOperations[request.Status]
+	if !found {
+		logger.Error("raiseException ERROR : unknown exception status " + request.Status + "!!\n")
+		return errorResponse(ERR_BAD_ARGS, "raiseException", "unknown exception status "+request.Status+"!!")
+	}
+	if len(request.Reason) == 0 {
+		logger.Error("raiseException ERROR : the reason must not be empty!!\n")
+		return errorResponse(ERR_BAD_ARGS, "raiseException", "the reason must not be empty!!")
+	}
+	err = checkEvidenceHashes("raiseException", request.EvidenceHashes)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("raiseException", err)
+	}
+	COCKey, chainOfCustody, previous, err = loadChainOfCustody(stub, args[0])
+	if err != nil {
+		logger.Error("raiseException ERROR: loadChainOfCustody()\n")
+		return errorResponseFrom("raiseException", err)
+	}
+	err = checkConsignment(chainOfCustody, operation, "")
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("raiseException", err)
+	}
+	chainOfCustody.Status, err = applyTransition(operation, chainOfCustody.Status)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("raiseException", err)
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return errorResponseFrom("raiseException", err)
+	}
+	investigation = Investigation{
+		Id:              generateCustodyId(stub, "raiseException", callerUID, "", 0),
+		CustodyId:       chainOfCustody.Id,
+		ExceptionStatus: request.Status,
+		PriorStatus:     previous.Status,
+		Reason:          request.Reason,
+		EvidenceHashes:  request.EvidenceHashes,
+		OpenedBy:        callerUID,
+		OpenedAt:        txTime.UTC().Format(time.RFC3339),
+		Status:          INVESTIGATION_OPEN,
+	}
+	err = putInvestigation(stub, &investigation)
+	if err != nil {
+		logger.Error("raiseException ERROR: putInvestigation()\n")
+		return errorResponseFrom("raiseException", err)
+	}
+	chainOfCustody.InvestigationId = investigation.Id
+
+	byteCOC, err = storeChainOfCustody(stub, COCKey, &previous, chainOfCustody, operation, callerUID, callerRole, args)
+	if err != nil {
+		logger.Error("raiseException ERROR: storeChainOfCustody()\n")
+		return errorResponseFrom("raiseException", err)
+	}
+	err = stub.SetEvent("raiseException EVENT: ", byteCOC)
+	if err != nil {
+		logger.Error("raiseException ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, "raiseException", err.Error())
+	}
+	logger.Info("raiseException EVENT: ", string(byteCOC))
+	return shim.Success(byteCOC)
+}
+
+//RESOLVEINVESTIGATION: args are the custody id and the json with the resolution, a note
+//and the optional hex sha256 of further evidences.
+//'restore' brings the ChainOfCustody back to the status it had when the exception was raised,
+//'terminate' releases it with a loss record.
+//The caller must be a OPERATOR/ADMIN, only a ADMIN can terminate!!
+
+func (t *DcotWorkflowChaincode) resolveInvestigation(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("resolveInvestigation()")
+
+	var err error
+	var callerRole, callerUID string
+	var COCKey string
+	var chainOfCustody *ChainOfCustody
+	var previous ChainOfCustody
+	var request ResolutionRequest
+	var investigation *Investigation
+	var operation, transition string
+	var found bool
+	var byteCOC []byte
+
+	if len(args) != 2 {
+		return errorResponse(ERR_BAD_ARGS, "resolveInvestigation", "this method must want exactly two arguments!!")
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("resolveInvestigation ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("resolveInvestigation", err)
+	}
+	err = json.Unmarshal([]byte(args[1]), &request)
+	if err != nil {
+		logger.Error("resolveInvestigation ERROR: json.Unmarshal()\n")
+		return errorResponse(ERR_BAD_ARGS, "resolveInvestigation", err.Error())
+	}
+	if request.Resolution == RESOLUTION_RESTORE {
+		operation = "restoreException"
+	} else if request.Resolution == RESOLUTION_TERMINATE {
+		operation = "closeAsLoss"
+	} else {
+		logger.Error("resolveInvestigation ERROR : unknown resolution " + request.Resolution + "!!\n")
+		return errorResponse(ERR_BAD_ARGS, "resolveInvestigation", "unknown resolution "+request.Resolution+"!!")
+	}
+	if len(request.EvidenceHashes) != 0 {
+		err = checkEvidenceHashes("resolveInvestigation", request.EvidenceHashes)
+		if err != nil {
+			logger.Error(err.Error())
+			return errorResponseFrom("resolveInvestigation", err)
+		}
+	}
+	COCKey, chainOfCustody, previous, err = loadChainOfCustody(stub, args[0])
+	if err != nil {
+		logger.Error("resolveInvestigation ERROR: loadChainOfCustody()\n")
+		return errorResponseFrom("resolveInvestigation", err)
+	}
+	if len(chainOfCustody.InvestigationId) == 0 {
+		logger.Error("resolveInvestigation ERROR : there is no open investigation!!\n")
+		return errorResponse(ERR_INVALID_STATE, "resolveInvestigation", "there is no open investigation!!")
+	}
+	err = checkPermissionOn(stub, operation, chainPermissionSubject(chainOfCustody))
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("resolveInvestigation", err)
+	}
+	investigation, err = getInvestigation(stub, chainOfCustody.Id, chainOfCustody.InvestigationId)
+	if err != nil {
+		logger.Error("resolveInvestigation ERROR: getInvestigation()\n")
+		return errorResponseFrom("resolveInvestigation", err)
+	}
+	transition = operation
+	if operation == "restoreException" {
+		transition, found = restoreOperations[investigation.PriorStatus]
+		if !found {
+			logger.Error("resolveInvestigation ERROR : the prior status " + investigation.PriorStatus + " can't be restored!!\n")
+			return errorResponse(ERR_INVALID_STATE, "resolveInvestigation", "the prior status "+investigation.PriorStatus+" can't be restored!!")
+		}
+	}
+	chainOfCustody.Status, err = applyTransition(transition, chainOfCustody.Status)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("resolveInvestigation", err)
+	}
+	if operation == "closeAsLoss" {
+		chainOfCustody.PendingCustodian = ""
+		chainOfCustody.TransferDeadline = ""
+		chainOfCustody.ReleaseReason = RELEASE_LOSS
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return errorResponseFrom("resolveInvestigation", err)
+	}
+	investigation.Status = INVESTIGATION_RESOLVED
+	investigation.Resolution = request.Resolution
+	investigation.ResolutionNote = request.Note
+	investigation.EvidenceHashes = append(investigation.EvidenceHashes, request.EvidenceHashes...)
+	investigation.ResolvedBy = callerUID
+	investigation.ResolvedAt = txTime.UTC().Format(time.RFC3339)
+	err = putInvestigation(stub, investigation)
+	if err != nil {
+		logger.Error("resolveInvestigation ERROR: putInvestigation()\n")
+		return errorResponseFrom("resolveInvestigation", err)
+	}
+	chainOfCustody.InvestigationId = ""
+
+	byteCOC, err = storeChainOfCustody(stub, COCKey, &previous, chainOfCustody, operation, callerUID, callerRole, args)
+	if err != nil {
+		logger.Error("resolveInvestigation ERROR: storeChainOfCustody()\n")
+		return errorResponseFrom("resolveInvestigation", err)
+	}
+	err = stub.SetEvent("resolveInvestigation EVENT: ", byteCOC)
+	if err != nil {
+		logger.Error("resolveInvestigation ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, "resolveInvestigation", err.Error())
+	}
+	logger.Info("resolveInvestigation EVENT: ", string(byteCOC))
+	return shim.Success(byteCOC)
+}
+
+//GETINVESTIGATIONS: returns all the investigations opened on a ChainOfCustody.
+//The caller must have the same roles required by getAssetDetails!!
+
+func (t *DcotWorkflowChaincode) getInvestigations(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("getInvestigations()")
+
+	var err error
+	var resultsIterator shim.StateQueryIteratorInterface
+	var jsonResp []byte
+
+	investigations := []Investigation{}
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, "getInvestigations", "this method must want exactly one argument!!")
+	}
+	resultsIterator, err = stub.GetStateByPartialCompositeKey(INVESTIGATION_KEY, []string{args[0]})
+	if err != nil {
+		logger.Error("getInvestigations ERROR: GetStateByPartialCompositeKey()\n")
+		return errorResponse(ERR_LEDGER, "getInvestigations", err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		var investigation Investigation
+
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return errorResponse(ERR_LEDGER, "getInvestigations", err.Error())
+		}
+		err = json.Unmarshal(queryResponse.Value, &investigation)
+		if err != nil {
+			logger.Error("getInvestigations ERROR: json.Unmarshal()\n")
+			return errorResponse(ERR_CORRUPT_RECORD, "getInvestigations", queryResponse.Key+" can't be decoded: "+err.Error())
+		}
+		investigations = append(investigations, investigation)
+	}
+	jsonResp, err = json.Marshal(investigations)
+	if err != nil {
+		logger.Error("getInvestigations ERROR: json.Marshal()\n")
+		return errorResponseFrom("getInvestigations", err)
+	}
+	logger.Debug("Query Response:\n" + string(jsonResp))
+	return shim.Success(jsonResp)
+}
+
+func checkEvidenceHashes(operation string, evidenceHashes []string) error {
+	if len(evidenceHashes) == 0 {
+		return newError(ERR_BAD_ARGS, operation, "at least one evidence hash is required!!")
+	}
+	for _, evidenceHash := range evidenceHashes {
+		if !sha256Pattern.MatchString(evidenceHash) {
+			return newError(ERR_BAD_ARGS, operation, "the evidence hash "+evidenceHash+" must be a lowercase hex sha256!!")
+		}
+	}
+	return nil
+}
+
+func getInvestigation(stub shim.ChaincodeStubInterface, custodyId string, investigationId string) (*Investigation, error) {
+	var investigation Investigation
+
+	investigationKey, err := getInvestigationKey(stub, custodyId, investigationId)
+	if err != nil {
+		return nil, newError(ERR_BAD_ARGS, "", err.Error())
+	}
+	err = loadRecord(stub, investigationKey, "Investigation", investigationId, &investigation)
+	if err != nil {
+		return nil, err
+	}
+	return &investigation, nil
+}
+
+func putInvestigation(stub shim.ChaincodeStubInterface, investigation *Investigation) error {
+	investigationKey, err := getInvestigationKey(stub, investigation.CustodyId, investigation.Id)
+	if err != nil {
+		return err
+	}
+	investigation.DocType = DOC_TYPE_INVESTIGATION
+	investigationBytes, err := json.Marshal(investigation)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(investigationKey, investigationBytes)
+	if err != nil {
+		return newError(ERR_LEDGER, "", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// maximum difference accepted between the weight of a parcel and the sum of its pieces
+const WEIGHT_TOLERANCE = 0.001
+
+//SPLITCHAIN: args are the custody id of the parent and the json array of the children,
+//an optional third argument is the client's idempotency key.
+//Every child may contain only its TrackingId and a positive WeightOfParcel, the other fields and the OTP are copied from the parent.
+//Either every child has a weight, and the sum must match the parent's one, or none has it and the parent's weight is divided evenly.
+//A child without TrackingId gets the parent's one followed by -N, the TrackingIds of the children must be different.
+//The parent is released as 'split', the caller must be its current custodian!!
+
+func (t *DcotWorkflowChaincode) splitChain(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("splitChain()")
+
+	var err error
+	var callerRole, callerUID string
+	var idempotencyKey string
+	var COCKey string
+	var parent *ChainOfCustody
+	var previous ChainOfCustody
+	var items []json.RawMessage
+	var children []ChainOfCustody
+	var totalWeight float64
+	var weighted int
+	var lineage Lineage
+	var byteResp []byte
+
+	operation := "splitChain"
+	childKeys := []string{}
+	itemErrors := []BatchItemError{}
+	seen := make(map[string]bool)
+
+	if len(args) != 2 && len(args) != 3 {
+		return errorResponse(ERR_BAD_ARGS, "splitChain", "this method must want two or three arguments!!")
+	}
+	if len(args) == 3 {
+		idempotencyKey = args[2]
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("splitChain ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("splitChain", err)
+	}
+	COCKey, parent, previous, err = loadChainOfCustody(stub, args[0])
+	if err != nil {
+		logger.Error("splitChain ERROR: loadChainOfCustody()\n")
+		return errorResponseFrom("splitChain", err)
+	}
+	err = checkConsignment(parent, operation, "")
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("splitChain", err)
+	}
+	parent.Status, err = applyTransition(operation, parent.Status)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("splitChain", err)
+	}
+	err = json.Unmarshal([]byte(args[1]), &items)
+	if err != nil {
+		logger.Error("splitChain ERROR: json.Unmarshal()\n")
+		return errorResponse(ERR_BAD_ARGS, "splitChain", err.Error())
+	}
+	if len(items) < 2 {
+		return errorResponse(ERR_BAD_ARGS, "splitChain", "a parcel must be split in at least two children!!")
+	}
+	for index, item := range items {
+		child, fieldErrors := decodeChainOfCustody(item, SPLIT_CHILD_FIELDS, nil)
+		if len(fieldErrors) != 0 {
+			itemErrors = append(itemErrors, BatchItemError{index, child.TrackingId, "the child is not valid", fieldErrors})
+		} else if len(child.TrackingId) == 0 {
+			child.TrackingId = fmt.Sprintf("%s-%d", parent.TrackingId, index+1)
+			if !trackingIdRegexp.MatchString(child.TrackingId) {
+				itemErrors = append(itemErrors, BatchItemError{index, child.TrackingId, "the generated TrackingId is not valid", []FieldError{{"trackingId", "must match " + TRACKING_ID_PATTERN}}})
+			}
+		}
+		if len(child.TrackingId) != 0 && seen[child.TrackingId] {
+			itemErrors = append(itemErrors, BatchItemError{index, child.TrackingId, "the TrackingId is repeated", []FieldError{{"trackingId", "is repeated"}}})
+		}
+		seen[child.TrackingId] = true
+		children = append(children, child)
+		totalWeight += child.WeightOfParcel
+		if child.WeightOfParcel > 0 {
+			weighted++
+		}
+	}
+	if len(itemErrors) != 0 {
+		logger.Error("splitChain ERROR: invalid children!!\n")
+		return errorResponseWithDetails(ERR_BAD_ARGS, "splitChain", "invalid children", itemErrors)
+	}
+	if weighted != 0 && weighted != len(children) {
+		logger.Error("splitChain ERROR: either every child or none must have a weight!!\n")
+		return errorResponse(ERR_BAD_ARGS, "splitChain", "either every child or none must have a weight!!")
+	}
+	if totalWeight != 0 && math.Abs(totalWeight-parent.WeightOfParcel) > WEIGHT_TOLERANCE {
+		logger.Error("splitChain ERROR: the weights of the children don't match the weight of the parent!!\n")
+		return errorResponse(ERR_BAD_ARGS, "splitChain", "the weights of the children don't match the weight of the parent!!")
+	}
+
+	for index := range children {
+		child := &children[index]
+		if totalWeight == 0 {
+			child.WeightOfParcel = parent.WeightOfParcel / float64(len(children))
+		}
+		child.DocumentId = parent.DocumentId
+		child.SortingCenterDestination = parent.SortingCenterDestination
+		child.DistributionOfficeCode = parent.DistributionOfficeCode
+		child.DistributionZone = parent.DistributionZone
+		child.CodeOwner = parent.CodeOwner
+		child.ProofOfDelivery = nil
+		child.DeliveryAttempts = nil
+		child.ParentIds = []string{parent.Id}
+		child.Id = generateCustodyId(stub, operation, callerUID, idempotencyKey, index)
+		err = copyDeliveryOtp(stub, parent, child)
+		if err != nil {
+			logger.Error("splitChain ERROR: copyDeliveryOtp()\n")
+			return errorResponseFrom("splitChain", err)
+		}
+
+		childKey, err := getCOCKey(stub, child.Id)
+		if err != nil {
+			return errorResponseFrom("splitChain", err)
+		}
+		exists, err := recordExists(stub, childKey)
+		if err != nil {
+			logger.Error("splitChain ERROR: recordExists()\n")
+			return errorResponseFrom("splitChain", err)
+		}
+		if exists {
+			logger.Error("splitChain ERROR: ChainOfCustody " + child.Id + " already exists!!\n")
+			return errorResponse(ERR_ALREADY_EXISTS, "splitChain", "ChainOfCustody "+child.Id+" already exists!!")
+		}
+		childKeys = append(childKeys, childKey)
+		parent.ChildIds = append(parent.ChildIds, child.Id)
+	}
+	parent.ReleaseReason = RELEASE_SPLIT
+
+	_, err = storeChainOfCustody(stub, COCKey, &previous, parent, operation, callerUID, callerRole, args[:2])
+	if err != nil {
+		logger.Error("splitChain ERROR: storeChainOfCustody()\n")
+		return errorResponseFrom("splitChain", err)
+	}
+	for index := range children {
+		_, err = storeNewChainOfCustody(stub, childKeys[index], &children[index], operation, parent.Custodian, callerUID, callerRole, []string{parent.Id})
+		if err != nil {
+			logger.Error("splitChain ERROR: storeNewChainOfCustody()\n")
+			return errorResponseFrom("splitChain", err)
+		}
+	}
+	lineage = Lineage{Id: parent.Id, Parents: []ChainOfCustody{}, Children: children}
+	byteResp, err = json.Marshal(lineage)
+	if err != nil {
+		logger.Error("splitChain ERROR: json.Marshal()\n")
+		return errorResponseFrom("splitChain", err)
+	}
+	err = stub.SetEvent("splitChain EVENT: ", byteResp)
+	if err != nil {
+		logger.Error("splitChain ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, "splitChain", err.Error())
+	}
+	logger.Info("splitChain EVENT: ", string(byteResp))
+	return shim.Success(byteResp)
+}
+
+//MERGECHAINS: args are the json array of the custody ids to merge and the json of the new record,
+//that may contain only the MERGED_CHAIN_FIELDS,
+//an optional third argument is the client's idempotency key.
+//The weight of the new record is the sum of the merged ones, the empty fields and the OTP are copied
+//from the first merged record and the TrackingId, when empty, from their common parent.
+//The merged records must require the same OTP or none, see checkSameDeliveryOtp.
+//Every merged record is checked with the rows of mergeSource of the permission matrix, if one fails nothing is merged.
+//The merged records are released as 'merged', the caller must be their current custodian!!
+
+func (t *DcotWorkflowChaincode) mergeChains(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("mergeChains()")
+
+	var err error
+	var callerRole, callerUID string
+	var idempotencyKey string
+	var custodyIds []string
+	var merged ChainOfCustody
+	var fieldErrors []FieldError
+	var mergedKey string
+	var exists bool
+	var lineage Lineage
+	var byteResp []byte
+
+	operation := "mergeChains"
+	sources := []ChainOfCustody{}
+	sourceKeys := []string{}
+	previousSources := []ChainOfCustody{}
+	seen := make(map[string]bool)
+
+	if len(args) != 2 && len(args) != 3 {
+		return errorResponse(ERR_BAD_ARGS, "mergeChains", "this method must want two or three arguments!!")
+	}
+	if len(args) == 3 {
+		idempotencyKey = args[2]
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("mergeChains ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("mergeChains", err)
+	}
+	err = json.Unmarshal([]byte(args[0]), &custodyIds)
+	if err != nil {
+		logger.Error("mergeChains ERROR: json.Unmarshal()\n")
+		return errorResponse(ERR_BAD_ARGS, "mergeChains", err.Error())
+	}
+	if len(custodyIds) < 2 {
+		return errorResponse(ERR_BAD_ARGS, "mergeChains", "at least two parcels must be merged!!")
+	}
+	merged, fieldErrors = decodeChainOfCustody([]byte(args[1]), MERGED_CHAIN_FIELDS, nil)
+	if len(fieldErrors) != 0 {
+		logger.Error("mergeChains ERROR: the new ChainOfCustody is not valid!!\n")
+		return errorResponseWithDetails(ERR_BAD_ARGS, "mergeChains", "the new ChainOfCustody is not valid!!", fieldErrors)
+	}
+	merged.Id = generateCustodyId(stub, operation, callerUID, idempotencyKey, 0)
+	merged.WeightOfParcel = 0
+
+	for _, custodyId := range custodyIds {
+		if seen[custodyId] {
+			return errorResponse(ERR_BAD_ARGS, "mergeChains", custodyId+" is repeated!!")
+		}
+		seen[custodyId] = true
+		COCKey, source, previous, err := loadChainOfCustody(stub, custodyId)
+		if err != nil {
+			logger.Error("mergeChains ERROR: loadChainOfCustody() " + custodyId + "\n")
+			return errorResponseFrom("mergeChains", wrapError("mergeChains", err, custodyId))
+		}
+		err = checkPermissionOn(stub, "mergeSource", chainPermissionSubject(source))
+		if err != nil {
+			logger.Error("mergeChains ERROR: " + custodyId + ": " + err.Error() + "\n")
+			return errorResponseFrom("mergeChains", wrapError("mergeChains", err, custodyId))
+		}
+		if len(sources) != 0 && source.Custodian != sources[0].Custodian {
+			logger.Error("mergeChains ERROR : " + custodyId + " has another custodian!!\n")
+			return errorResponse(ERR_FORBIDDEN, "mergeChains", "The parcels to merge must have the same custodian, "+custodyId+" has another one!!")
+		}
+		delegated, err := actsFor(stub, callerUID, source.Custodian)
+		if err != nil {
+			logger.Error("mergeChains ERROR: actsFor() " + custodyId + "\n")
+			return errorResponseFrom("mergeChains", err)
+		}
+		if !delegated {
+			logger.Error("mergeChains ERROR : The caller must be the current custodian of " + custodyId + "!!\n")
+			return errorResponse(ERR_FORBIDDEN, "mergeChains", "The caller must be the current custodian of "+custodyId+"!!")
+		}
+		err = checkConsignment(source, operation, "")
+		if err == nil {
+			source.Status, err = applyTransition(operation, source.Status)
+		}
+		if err != nil {
+			logger.Error(err.Error())
+			return errorResponseFrom("mergeChains", wrapError("mergeChains", err, custodyId))
+		}
+		source.ChildIds = append(source.ChildIds, merged.Id)
+		source.ReleaseReason = RELEASE_MERGED
+		merged.WeightOfParcel += source.WeightOfParcel
+		merged.ParentIds = append(merged.ParentIds, custodyId)
+
+		sources = append(sources, *source)
+		sourceKeys = append(sourceKeys, COCKey)
+		previousSources = append(previousSources, previous)
+	}
+
+	if len(merged.TrackingId) == 0 {
+		merged.TrackingId, err = commonParentTrackingId(stub, sources)
+		if err != nil {
+			logger.Error(err.Error())
+			return errorResponseFrom("mergeChains", err)
+		}
+	}
+	if len(merged.DocumentId) == 0 {
+		merged.DocumentId = sources[0].DocumentId
+	}
+	if len(merged.SortingCenterDestination) == 0 {
+		merged.SortingCenterDestination = sources[0].SortingCenterDestination
+	}
+	if len(merged.DistributionOfficeCode) == 0 {
+		merged.DistributionOfficeCode = sources[0].DistributionOfficeCode
+	}
+	if len(merged.DistributionZone) == 0 {
+		merged.DistributionZone = sources[0].DistributionZone
+	}
+	if len(merged.CodeOwner) == 0 {
+		merged.CodeOwner = sources[0].CodeOwner
+	}
+	merged.ProofOfDelivery = nil
+	merged.DeliveryAttempts = nil
+	err = checkSameDeliveryOtp(stub, sources)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("mergeChains", err)
+	}
+	err = copyDeliveryOtp(stub, &sources[0], &merged)
+	if err != nil {
+		logger.Error("mergeChains ERROR: copyDeliveryOtp()\n")
+		return errorResponseFrom("mergeChains", err)
+	}
+	mergedKey, err = getCOCKey(stub, merged.Id)
+	if err != nil {
+		return errorResponseFrom("mergeChains", err)
+	}
+	exists, err = recordExists(stub, mergedKey)
+	if err != nil {
+		logger.Error("mergeChains ERROR: recordExists()\n")
+		return errorResponseFrom("mergeChains", err)
+	}
+	if exists {
+		logger.Error("mergeChains ERROR: ChainOfCustody " + merged.Id + " already exists!!\n")
+		return errorResponse(ERR_ALREADY_EXISTS, "mergeChains", "ChainOfCustody "+merged.Id+" already exists!!")
+	}
+
+	for index := range sources {
+		_, err = storeChainOfCustody(stub, sourceKeys[index], &previousSources[index], &sources[index], operation, callerUID, callerRole, []string{merged.Id})
+		if err != nil {
+			logger.Error("mergeChains ERROR: storeChainOfCustody()\n")
+			return errorResponseFrom("mergeChains", err)
+		}
+	}
+	_, err = storeNewChainOfCustody(stub, mergedKey, &merged, operation, sources[0].Custodian, callerUID, callerRole, args[:2])
+	if err != nil {
+		logger.Error("mergeChains ERROR: storeNewChainOfCustody()\n")
+		return errorResponseFrom("mergeChains", err)
+	}
+	lineage = Lineage{Id: merged.Id, Parents: sources, Children: []ChainOfCustody{}}
+	byteResp, err = json.Marshal(lineage)
+	if err != nil {
+		logger.Error("mergeChains ERROR: json.Marshal()\n")
+		return errorResponseFrom("mergeChains", err)
+	}
+	err = stub.SetEvent("mergeChains EVENT: ", byteResp)
+	if err != nil {
+		logger.Error("mergeChains ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, "mergeChains", err.Error())
+	}
+	logger.Info("mergeChains EVENT: ", string(byteResp))
+	return shim.Success(byteResp)
+}
+
+//GETLINEAGE: returns a ChainOfCustody's parents (the record it was split from or the records
+//merged into it) and children (the records it was split into or merged into).
+//The caller must have the same roles required by getAssetDetails!!
+
+func (t *DcotWorkflowChaincode) getLineage(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("getLineage()")
+
+	var err error
+	var chainOfCustody *ChainOfCustody
+	var lineage Lineage
+	var jsonResp []byte
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, "getLineage", "this method must want exactly one argument!!")
+	}
+	_, chainOfCustody, _, err = loadChainOfCustody(stub, args[0])
+	if err != nil {
+		logger.Error("getLineage ERROR: loadChainOfCustody()\n")
+		return errorResponseFrom("getLineage", err)
+	}
+	lineage.Id = chainOfCustody.Id
+	lineage.Parents, err = loadLinkedChains(stub, chainOfCustody.ParentIds)
+	if err != nil {
+		logger.Error("getLineage ERROR: loadLinkedChains()\n")
+		return errorResponseFrom("getLineage", err)
+	}
+	lineage.Children, err = loadLinkedChains(stub, chainOfCustody.ChildIds)
+	if err != nil {
+		logger.Error("getLineage ERROR: loadLinkedChains()\n")
+		return errorResponseFrom("getLineage", err)
+	}
+	jsonResp, err = json.Marshal(lineage)
+	if err != nil {
+		logger.Error("getLineage ERROR: json.Marshal()\n")
+		return errorResponseFrom("getLineage", err)
+	}
+	logger.Debug("Query Response:\n" + string(jsonResp))
+	return shim.Success(jsonResp)
+}
+
+func loadLinkedChains(stub shim.ChaincodeStubInterface, custodyIds []string) ([]ChainOfCustody, error) {
+	chainsOfCustody := []ChainOfCustody{}
+
+	for _, custodyId := range custodyIds {
+		_, chainOfCustody, _, err := loadChainOfCustody(stub, custodyId)
+		if err != nil {
+			return nil, err
+		}
+		chainsOfCustody = append(chainsOfCustody, *chainOfCustody)
+	}
+	return chainsOfCustody, nil
+}
+
+//CHECKSAMEDELIVERYOTP: only one OTP can be carried over to the merged record, so either none of
+//the records requires an OTP or all of them require the same one, e.g. the children of a split
+
+func checkSameDeliveryOtp(stub shim.ChaincodeStubInterface, chainsOfCustody []ChainOfCustody) error {
+	var first *DeliveryOtp
+
+	for index := range chainsOfCustody {
+		deliveryOtp, err := loadDeliveryOtp(stub, &chainsOfCustody[index])
+		if err != nil {
+			return err
+		}
+		if index == 0 {
+			first = deliveryOtp
+			continue
+		}
+		if (first == nil) != (deliveryOtp == nil) || (first != nil && (first.Salt != deliveryOtp.Salt || first.Hash != deliveryOtp.Hash || first.Iterations != deliveryOtp.Iterations)) {
+			return newError(ERR_BAD_ARGS, "mergeChains", "the parcels to merge must require the same OTP or none, "+chainsOfCustody[index].Id+" differs!!")
+		}
+	}
+	return nil
+}
+
+//COMMONPARENTTRACKINGID: the TrackingId of the parent the records were split from,
+//if all of them come from the same split
+
+func commonParentTrackingId(stub shim.ChaincodeStubInterface, chainsOfCustody []ChainOfCustody) (string, error) {
+	var parentId string
+
+	for _, chainOfCustody := range chainsOfCustody {
+		if len(chainOfCustody.ParentIds) != 1 || (parentId != "" && chainOfCustody.ParentIds[0] != parentId) {
+			return "", newError(ERR_BAD_ARGS, "mergeChains", "Tracking ID must not be null or empty string if the parcels don't come from the same split!!")
+		}
+		parentId = chainOfCustody.ParentIds[0]
+	}
+	_, parent, _, err := loadChainOfCustody(stub, parentId)
+	if err != nil {
+		return "", err
+	}
+	return parent.TrackingId, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSplitChainChecksTheChildren(t *testing.T) {
+	var lineage Lineage
+
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+
+	stub.register(t, admin, operator)
+	custodyId := stub.newChain(t, member, "T1")
+	longTrackingId := strings.Repeat("L", 63)
+	longId := stub.newChain(t, member, longTrackingId)
+	stub.mustInvoke(t, member, "startTransferBatch", `["`+custodyId+`","`+longId+`"]`, "op1")
+	stub.mustInvoke(t, operator, "completeTransferBatch", `["`+custodyId+`","`+longId+`"]`)
+
+	stub.expectError(t, ERR_BAD_ARGS, operator, "splitChain", custodyId, `[{"weightOfParcel":2},{}]`)
+	stub.expectError(t, ERR_BAD_ARGS, operator, "splitChain", custodyId, `[{"weightOfParcel":3},{"weightOfParcel":-1}]`)
+	stub.expectError(t, ERR_BAD_ARGS, operator, "splitChain", custodyId, `[{"weightOfParcel":2},{"weightOfParcel":0}]`)
+	stub.expectError(t, ERR_BAD_ARGS, operator, "splitChain", custodyId, `[{"trackingId":"C1"},{"trackingId":"C1"}]`)
+	stub.expectError(t, ERR_BAD_ARGS, operator, "splitChain", custodyId, `[{"trackingId":"T1-2"},{}]`)
+	stub.expectError(t, ERR_BAD_ARGS, operator, "splitChain", longId, `[{},{}]`)
+	if status := stub.getChain(t, custodyId).Status; status != IN_CUSTODY {
+		t.Fatalf("a refused split changed the status of the parent to %s", status)
+	}
+
+	payload := stub.mustInvoke(t, operator, "splitChain", custodyId, `[{"weightOfParcel":1.5},{"trackingId":"C2","weightOfParcel":0.5}]`)
+	json.Unmarshal(payload, &lineage)
+	if len(lineage.Children) != 2 || lineage.Children[0].TrackingId != "T1-1" || lineage.Children[1].TrackingId != "C2" || lineage.Children[0].WeightOfParcel != 1.5 {
+		t.Fatalf("children of the split: %+v", lineage.Children)
+	}
+	payload = stub.mustInvoke(t, operator, "splitChain", longId, `[{"trackingId":"A"},{"trackingId":"B"}]`)
+	json.Unmarshal(payload, &lineage)
+	if lineage.Children[0].WeightOfParcel != 1 || lineage.Children[1].WeightOfParcel != 1 {
+		t.Fatalf("the weight is not divided evenly: %+v", lineage.Children)
+	}
+}
+
+func TestMergeChainsChecksTheJurisdictionOfEverySource(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+	movedOperator := newOfficeCaller("op1", CALLER_ROLE_2, "MI01")
+
+	stub.register(t, admin, operator)
+	first := stub.newChain(t, member, "T1")
+	second := stub.newChain(t, member, "T2")
+	var foreign ChainOfCustody
+	payload := stub.mustInvoke(t, member, "initNewChain", `{"trackingId":"T3","documentId":"DT3","weightOfParcel":2,"sortingCenterDestination":"SC1","distributionOfficeCode":"MI01"}`)
+	json.Unmarshal(payload, &foreign)
+	stub.mustInvoke(t, member, "startTransferBatch", `["`+first+`","`+second+`"]`, "op1")
+	stub.mustInvoke(t, operator, "completeTransferBatch", `["`+first+`","`+second+`"]`)
+	stub.expectError(t, ERR_BAD_ARGS, member, "startTransfer", foreign.Id, "op1")
+	stub.register(t, admin, movedOperator)
+	stub.mustInvoke(t, member, "startTransfer", foreign.Id, "op1")
+	stub.mustInvoke(t, movedOperator, "completeTrasfer", foreign.Id)
+
+	stub.expectError(t, ERR_FORBIDDEN, operator, "mergeChains", `["`+first+`","`+foreign.Id+`"]`, `{"trackingId":"M1"}`)
+	if status := stub.getChain(t, first).Status; status != IN_CUSTODY {
+		t.Fatalf("a refused merge changed the status of the first source to %s", status)
+	}
+	stub.mustInvoke(t, operator, "mergeChains", `["`+first+`","`+second+`"]`, `{"trackingId":"M1"}`)
+}
+
+func TestMergeChainsNeedsTheSameOtp(t *testing.T) {
+	var lineage Lineage
+
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+	newChainWithOtp := func(trackingId string, salt string) string {
+		var chainOfCustody ChainOfCustody
+
+		stub.transient = map[string][]byte{OTP_TRANSIENT_KEY: []byte("12345678"), OTP_SALT_TRANSIENT_KEY: []byte(salt)}
+		payload := stub.mustInvoke(t, member, "initNewChain", `{"trackingId":"`+trackingId+`","documentId":"D1","weightOfParcel":2,"sortingCenterDestination":"SC1","distributionOfficeCode":"RM01"}`)
+		json.Unmarshal(payload, &chainOfCustody)
+		return chainOfCustody.Id
+	}
+
+	stub.register(t, admin, operator)
+	first := newChainWithOtp("T1", "0123456789abcdef")
+	other := newChainWithOtp("T2", "fedcba9876543210")
+	plain := stub.newChain(t, member, "T3")
+	ids := `["` + first + `","` + other + `","` + plain + `"]`
+	stub.mustInvoke(t, member, "startTransferBatch", ids, "op1")
+	stub.mustInvoke(t, operator, "completeTransferBatch", ids)
+
+	stub.expectError(t, ERR_BAD_ARGS, operator, "mergeChains", `["`+first+`","`+plain+`"]`, `{"trackingId":"M1"}`)
+	stub.expectError(t, ERR_BAD_ARGS, operator, "mergeChains", `["`+plain+`","`+first+`"]`, `{"trackingId":"M1"}`)
+	stub.expectError(t, ERR_BAD_ARGS, operator, "mergeChains", `["`+first+`","`+other+`"]`, `{"trackingId":"M1"}`)
+
+	payload := stub.mustInvoke(t, operator, "splitChain", first, `[{},{}]`)
+	json.Unmarshal(payload, &lineage)
+	payload = stub.mustInvoke(t, operator, "mergeChains", `["`+lineage.Children[0].Id+`","`+lineage.Children[1].Id+`"]`, `{}`)
+	lineage = Lineage{}
+	json.Unmarshal(payload, &lineage)
+	if merged := stub.getChain(t, lineage.Id); !merged.OtpRequired || merged.TrackingId != "T1" {
+		t.Fatalf("record merged from the children of a split: %+v", merged)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//MIGRATECHAINOFCUSTODY: moves a ChainOfCustody stored with the legacy DeliveryMan layout
+//to the Custodian/PendingCustodian layout and sets the docType of the records stored without it.
+//The OTP hash of a legacy record is taken out of the record, storeChainOfCustody stores it apart.
+//It returns the record as it was stored, with Custodian set to the legacy DeliveryMan
+//so that its index entries can be found and removed.
+//In a legacy TRANSFER_PENDING record DeliveryMan is the receiver and the previous custodian
+//may be lost, in that case Custodian stays empty and only an administrator can cancel the transfer.
+
+func migrateChainOfCustody(chainOfCustody *ChainOfCustody) ChainOfCustody {
+
+	stored := *chainOfCustody
+	chainOfCustody.DocType = DOC_TYPE_CHAIN
+	if len(chainOfCustody.OtpHash) != 0 {
+		chainOfCustody.legacyOtp = &DeliveryOtp{Salt: chainOfCustody.OtpSalt, Hash: chainOfCustody.OtpHash}
+		chainOfCustody.OtpRequired = true
+	}
+	chainOfCustody.OtpSalt = ""
+	chainOfCustody.OtpHash = ""
+	if len(chainOfCustody.Custodian) != 0 || len(chainOfCustody.DeliveryMan) == 0 {
+		return stored
+	}
+	stored.Custodian = chainOfCustody.DeliveryMan
+
+	if chainOfCustody.Status == TRANSFER_PENDING {
+		chainOfCustody.Custodian = chainOfCustody.PreviousDeliveryMan
+		chainOfCustody.PendingCustodian = chainOfCustody.DeliveryMan
+	} else {
+		chainOfCustody.Custodian = chainOfCustody.DeliveryMan
+	}
+	chainOfCustody.DeliveryMan = ""
+	chainOfCustody.PreviousDeliveryMan = ""
+	return stored
+}
+
+//QUALIFYCHAINOFCUSTODY: the custodians stored before the identities had a MSPID are bare UIDs,
+//they and the owner organization are assigned to mspid. Returns false if nothing changed.
+
+func qualifyChainOfCustody(chainOfCustody *ChainOfCustody, mspid string) bool {
+
+	qualified := false
+	if len(chainOfCustody.Custodian) != 0 && len(identityOrg(chainOfCustody.Custodian)) == 0 {
+		chainOfCustody.Custodian = qualifiedIdentity(mspid, chainOfCustody.Custodian)
+		qualified = true
+	}
+	if len(chainOfCustody.PendingCustodian) != 0 && len(identityOrg(chainOfCustody.PendingCustodian)) == 0 {
+		chainOfCustody.PendingCustodian = qualifiedIdentity(mspid, chainOfCustody.PendingCustodian)
+		qualified = true
+	}
+	if len(chainOfCustody.OwnerOrg) == 0 {
+		chainOfCustody.OwnerOrg = mspid
+		qualified = true
+	}
+	return qualified
+}
+
+//MIGRATECHAINS: rewrites every ChainOfCustody still stored with the legacy layout, without docType
+//or with the OTP hash in the world state, and rebuilds the secondary index entries of every ChainOfCustody.
+//The optional argument is a MSPID, the bare UIDs of the custodians become identities of that
+//organization and the records without owner organization are assigned to it, see qualifyChainOfCustody.
+//The caller must be a Admin!!!
+
+func (t *DcotWorkflowChaincode) migrateChains(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("migrateChains()")
+
+	var err error
+	var migrated int
+	var mspid string
+
+	if len(args) > 1 {
+		return errorResponse(ERR_BAD_ARGS, "migrateChains", "this method wants at most one argument!!")
+	}
+	if len(args) == 1 {
+		mspid = args[0]
+	}
+	if strings.Contains(mspid, IDENTITY_SEPARATOR) {
+		return errorResponse(ERR_BAD_ARGS, "migrateChains", "the argument must be a MSPID!!")
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(COC_KEY, []string{})
+	if err != nil {
+		logger.Error("migrateChains ERROR: GetStateByPartialCompositeKey()\n")
+		return errorResponse(ERR_LEDGER, "migrateChains", err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		var chainOfCustody ChainOfCustody
+
+		cocEntry, err := resultsIterator.Next()
+		if err != nil {
+			logger.Error("migrateChains ERROR: resultsIterator.Next()\n")
+			return errorResponse(ERR_LEDGER, "migrateChains", err.Error())
+		}
+		err = json.Unmarshal(cocEntry.Value, &chainOfCustody)
+		if err != nil {
+			logger.Error("migrateChains ERROR: json.Unmarshal() " + cocEntry.Key + "\n")
+			return errorResponse(ERR_CORRUPT_RECORD, "migrateChains", cocEntry.Key+" can't be decoded: "+err.Error())
+		}
+		legacyLayout := len(chainOfCustody.Custodian) == 0 && len(chainOfCustody.DeliveryMan) != 0
+		untyped := len(chainOfCustody.DocType) == 0
+		stored := migrateChainOfCustody(&chainOfCustody)
+		qualified := len(mspid) != 0 && qualifyChainOfCustody(&chainOfCustody, mspid)
+		if !legacyLayout && !untyped && !qualified && chainOfCustody.legacyOtp == nil {
+			err = updateIndexes(stub, nil, &chainOfCustody)
+			if err != nil {
+				logger.Error("migrateChains ERROR: updateIndexes()\n")
+				return errorResponseFrom("migrateChains", err)
+			}
+			continue
+		}
+		err = storeLegacyOtp(stub, &chainOfCustody)
+		if err != nil {
+			logger.Error("migrateChains ERROR: storeLegacyOtp()\n")
+			return errorResponseFrom("migrateChains", err)
+		}
+		byteCOC, err := json.Marshal(&chainOfCustody)
+		if err != nil {
+			logger.Error("migrateChains ERROR: json.Marshal()\n")
+			return errorResponseFrom("migrateChains", err)
+		}
+		err = stub.PutState(cocEntry.Key, byteCOC)
+		if err != nil {
+			logger.Error("migrateChains ERROR: PutState()\n")
+			return errorResponse(ERR_LEDGER, "migrateChains", err.Error())
+		}
+		err = updateIndexes(stub, &stored, &chainOfCustody)
+		if err != nil {
+			logger.Error("migrateChains ERROR: updateIndexes()\n")
+			return errorResponseFrom("migrateChains", err)
+		}
+		migrated++
+	}
+	logger.Info("migrateChains: migrated records: ", migrated)
+	return shim.Success([]byte("{\"migrated\":" + strconv.Itoa(migrated) + "}"))
+}
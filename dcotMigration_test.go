@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMigrateChainOfCustodySplitsTheDeliveryMan(t *testing.T) {
+	held := ChainOfCustody{Id: "held", DeliveryMan: "d1", PreviousDeliveryMan: "d0", Status: IN_CUSTODY}
+	stored := migrateChainOfCustody(&held)
+	if held.Custodian != "d1" || len(held.PendingCustodian) != 0 || len(held.DeliveryMan) != 0 || len(held.PreviousDeliveryMan) != 0 || stored.Custodian != "d1" {
+		t.Fatalf("legacy record in custody: %+v, stored as %+v", held, stored)
+	}
+
+	pending := ChainOfCustody{Id: "pending", DeliveryMan: "d2", PreviousDeliveryMan: "d1", Status: TRANSFER_PENDING}
+	stored = migrateChainOfCustody(&pending)
+	if pending.Custodian != "d1" || pending.PendingCustodian != "d2" || len(pending.DeliveryMan) != 0 || stored.Custodian != "d2" {
+		t.Fatalf("legacy pending record: %+v, stored as %+v", pending, stored)
+	}
+
+	lost := ChainOfCustody{Id: "lost", DeliveryMan: "d2", Status: TRANSFER_PENDING}
+	migrateChainOfCustody(&lost)
+	if len(lost.Custodian) != 0 || lost.PendingCustodian != "d2" {
+		t.Fatalf("legacy pending record without the previous custodian: %+v", lost)
+	}
+
+	current := ChainOfCustody{Id: "current", Custodian: "d1", Status: IN_CUSTODY}
+	migrateChainOfCustody(&current)
+	if current.Custodian != "d1" || current.DocType != DOC_TYPE_CHAIN {
+		t.Fatalf("record of the current layout: %+v", current)
+	}
+}
+
+func TestMigratedPendingTransferUsesTheRightCustodian(t *testing.T) {
+	var found []ChainOfCustody
+
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+
+	stub.register(t, admin, operator)
+	legacy := ChainOfCustody{Id: "legacy", TrackingId: "T1", DocumentId: "D1", WeightOfParcel: 1, SortingCenterDestination: "SC1", DistributionOfficeCode: "RM01", DeliveryMan: "op1", PreviousDeliveryMan: "m1", Status: TRANSFER_PENDING}
+	legacyBytes, _ := json.Marshal(&legacy)
+	COCKey, _ := getCOCKey(stub, "legacy")
+	stub.MockTransactionStart("setup")
+	stub.PutState(COCKey, legacyBytes)
+	stub.MockTransactionEnd("setup")
+
+	stub.mustInvoke(t, admin, "migrateChains", "Org1MSP")
+	chainOfCustody := stub.getChain(t, "legacy")
+	if chainOfCustody.Custodian != member.identity() || chainOfCustody.PendingCustodian != operator.identity() || len(chainOfCustody.DeliveryMan) != 0 {
+		t.Fatalf("after migrateChains: custodian %q, pending %q, deliveryMan %q", chainOfCustody.Custodian, chainOfCustody.PendingCustodian, chainOfCustody.DeliveryMan)
+	}
+	payload := stub.mustInvoke(t, admin, "lookupByDeliveryMan", "m1", TRANSFER_PENDING)
+	json.Unmarshal(payload, &found)
+	if len(found) != 1 {
+		t.Fatalf("the migrated record is not indexed by its custodian: %s", string(payload))
+	}
+
+	stub.expectError(t, ERR_FORBIDDEN, operator, "commentChain", "legacy", "not yet mine")
+	stub.expectError(t, ERR_FORBIDDEN, operator, "cancelTrasfer", "legacy")
+	stub.mustInvoke(t, member, "cancelTrasfer", "legacy")
+	if chainOfCustody = stub.getChain(t, "legacy"); chainOfCustody.Custodian != member.identity() || chainOfCustody.Status != IN_CUSTODY {
+		t.Fatalf("after cancelTrasfer: custodian %q, status %s", chainOfCustody.Custodian, chainOfCustody.Status)
+	}
+}
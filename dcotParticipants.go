@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//REGISTERPARTICIPANT: creates or replaces a participant of the registry,
+//the input json must contain the UID and a known role, the org is the MSPID of the participant
+//and defaults to the caller's one. The participant is identified by Org/UID.
+//Office and zone are the jurisdiction of the participant when his certificate has no office.
+//The caller must be a Admin!!!
+
+func (t *DcotWorkflowChaincode) registerParticipant(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("registerParticipant()")
+
+	var err error
+	var participant Participant
+	var participantKey string
+	var participantBytes []byte
+	var callerUID, identity string
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, "registerParticipant", "this method must want exactly one argument!!")
+	}
+	err = json.Unmarshal([]byte(args[0]), &participant)
+	if err != nil {
+		logger.Error("registerParticipant ERROR: json.Unmarshal()\n")
+		return errorResponse(ERR_BAD_ARGS, "registerParticipant", err.Error())
+	}
+	if len(participant.UID) == 0 {
+		logger.Error("registerParticipant ERROR: UID must not be empty!!\n")
+		return errorResponse(ERR_BAD_ARGS, "registerParticipant", "UID must not be empty!!")
+	}
+	if !containsString(allRoles, participant.Role) {
+		logger.Error("registerParticipant ERROR: unknown role " + participant.Role + "!!\n")
+		return errorResponse(ERR_BAD_ARGS, "registerParticipant", "unknown role "+participant.Role+"!!")
+	}
+	if (len(participant.Office) != 0 && !officeCodeRegexp.MatchString(participant.Office)) || (len(participant.Zone) != 0 && !zoneRegexp.MatchString(participant.Zone)) {
+		logger.Error("registerParticipant ERROR: office or zone not valid!!\n")
+		return errorResponse(ERR_BAD_ARGS, "registerParticipant", "the office must match "+OFFICE_CODE_PATTERN+" and the zone "+ZONE_PATTERN+"!!")
+	}
+	if strings.Contains(participant.Org, IDENTITY_SEPARATOR) {
+		logger.Error("registerParticipant ERROR: the org must be a MSPID!!\n")
+		return errorResponse(ERR_BAD_ARGS, "registerParticipant", "the org must be a MSPID!!")
+	}
+	_, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("registerParticipant ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("registerParticipant", err)
+	}
+	if len(participant.Org) == 0 {
+		participant.Org = identityOrg(callerUID)
+	}
+	identity = qualifiedIdentity(participant.Org, participant.UID)
+	err = checkAdminOrg(stub, "registerParticipant", callerUID, identity)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("registerParticipant", err)
+	}
+	participantKey, err = getParticipantKey(stub, identity)
+	if err != nil {
+		logger.Error("registerParticipant ERROR: getParticipantKey()\n")
+		return errorResponseFrom("registerParticipant", err)
+	}
+	participant.DocType = DOC_TYPE_PARTICIPANT
+	participantBytes, err = json.Marshal(&participant)
+	if err != nil {
+		logger.Error("registerParticipant ERROR: json.Marshal()\n")
+		return errorResponseFrom("registerParticipant", err)
+	}
+	err = stub.PutState(participantKey, participantBytes)
+	if err != nil {
+		logger.Error("registerParticipant ERROR: PutState()\n")
+		return errorResponse(ERR_LEDGER, "registerParticipant", err.Error())
+	}
+	err = stub.SetEvent("registerParticipant EVENT: ", participantBytes)
+	if err != nil {
+		logger.Error("registerParticipant ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, "registerParticipant", err.Error())
+	}
+	logger.Info("registerParticipant EVENT: ", string(participantBytes))
+	return shim.Success(participantBytes)
+}
+
+//GETPARTICIPANTDETAILS: args is the identity of the participant, a bare UID is in the caller's organization
+//The caller must be a Admin!!!
+
+func (t *DcotWorkflowChaincode) getParticipantDetails(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("getParticipantDetails()")
+
+	var err error
+	var participant *Participant
+	var participantBytes []byte
+	var callerUID string
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, "getParticipantDetails", "this method must want exactly one argument!!")
+	}
+	_, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("getParticipantDetails ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("getParticipantDetails", err)
+	}
+	participant, err = getParticipant(stub, resolveIdentity(callerUID, args[0]))
+	if err != nil {
+		logger.Error("getParticipantDetails ERROR: getParticipant()\n")
+		return errorResponseFrom("getParticipantDetails", err)
+	}
+	if participant == nil {
+		logger.Error("getParticipantDetails ERROR: participant " + args[0] + " not found!!\n")
+		return errorResponse(ERR_NOT_FOUND, "getParticipantDetails", "participant "+args[0]+" not found!!")
+	}
+	participantBytes, err = json.Marshal(participant)
+	if err != nil {
+		logger.Error("getParticipantDetails ERROR: json.Marshal()\n")
+		return errorResponseFrom("getParticipantDetails", err)
+	}
+	return shim.Success(participantBytes)
+}
+
+//GETPARTICIPANT: returns nil if the identity (MSPID/UID) is not in the registry
+
+func getParticipant(stub shim.ChaincodeStubInterface, uid string) (*Participant, error) {
+	var participant Participant
+
+	participantKey, err := getParticipantKey(stub, uid)
+	if err != nil {
+		return nil, newError(ERR_BAD_ARGS, "", err.Error())
+	}
+	err = loadRecord(stub, participantKey, "Participant", uid, &participant)
+	if err != nil {
+		if chaincodeError, ok := err.(*ErrorResponse); ok && chaincodeError.Code == ERR_NOT_FOUND {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &participant, nil
+}
+
+//CHECKRECEIVER: the receiver of a transfer must be registered, active, not suspended
+//and have a role that can complete the transfer, his RoleAssignment is applied to the registered role.
+//subject is the parcel as it will be after the start of the transfer, nil for a consignment:
+//the receiver must pass the completeTrasfer rows on it with the jurisdiction of his registry entry,
+//otherwise the parcel would stay in 'TRANSFER_PENDING' until the deadline.
+
+func checkReceiver(stub shim.ChaincodeStubInterface, operation string, uid string, subject *PermissionSubject) error {
+
+	participant, err := getParticipant(stub, uid)
+	if err != nil {
+		return err
+	}
+	if participant == nil {
+		return newError(ERR_BAD_ARGS, operation, "the receiver "+uid+" is not a registered participant!!")
+	}
+	if !participant.Active {
+		return newError(ERR_BAD_ARGS, operation, "the receiver "+uid+" is not active!!")
+	}
+	effectiveRoles, suspended, err := getEffectiveRoles(stub, uid, participant.Role)
+	if err != nil {
+		return err
+	}
+	if suspended {
+		return newError(ERR_BAD_ARGS, operation, "the receiver "+uid+" is suspended!!")
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	if !isRoleAllowed(config.Permissions, "completeTrasfer", effectiveRoles...) {
+		return newError(ERR_BAD_ARGS, operation, "the receiver's role "+effectiveRoles[0]+" can't accept a transfer!!")
+	}
+	if subject == nil {
+		return nil
+	}
+	receiver := PermissionCaller{effectiveRoles, uid, adminOrg(config, TARGET_CHAIN, uid), func() (*Jurisdiction, error) {
+		return participantJurisdiction(participant), nil
+	}, func(owner string) (bool, error) {
+		return actsFor(stub, uid, owner)
+	}}
+	err = evaluatePermissions(config.Permissions, "completeTrasfer", receiver, func() (*PermissionSubject, error) {
+		return subject, nil
+	})
+	if chaincodeError, ok := err.(*ErrorResponse); ok && chaincodeError.Code == ERR_FORBIDDEN {
+		return newError(ERR_BAD_ARGS, operation, "the receiver "+uid+" can't complete the transfer: "+chaincodeError.Message)
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTransfersStartOnlyToReceiversThatCanCompleteThem(t *testing.T) {
+	var foreign ChainOfCustody
+	var consignment Consignment
+
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+
+	stub.register(t, admin, operator)
+	custodyId := stub.newChain(t, member, "T1")
+	payload := stub.mustInvoke(t, member, "initNewChain", `{"trackingId":"T2","documentId":"DT2","weightOfParcel":2,"sortingCenterDestination":"SC1","distributionOfficeCode":"MI01"}`)
+	json.Unmarshal(payload, &foreign)
+
+	stub.expectError(t, ERR_BAD_ARGS, member, "startTransfer", foreign.Id, "op1")
+	stub.expectError(t, ERR_BAD_ARGS, member, "startTransferBatch", `["`+custodyId+`","`+foreign.Id+`"]`, "op1")
+	payload = stub.mustInvoke(t, member, "createConsignment")
+	json.Unmarshal(payload, &consignment)
+	stub.mustInvoke(t, member, "addToConsignment", consignment.Id, `["`+foreign.Id+`"]`)
+	stub.expectError(t, ERR_BAD_ARGS, member, "startConsignmentTransfer", consignment.Id, "op1")
+	if chainOfCustody := stub.getChain(t, foreign.Id); chainOfCustody.Status != IN_CUSTODY || len(chainOfCustody.PendingCustodian) != 0 {
+		t.Fatalf("parcel after the refused transfers: status %s, pending %q", chainOfCustody.Status, chainOfCustody.PendingCustodian)
+	}
+	stub.mustInvoke(t, member, "startTransfer", custodyId, "op1")
+}
+
+func TestParticipantRegistryValidatesTheReceiver(t *testing.T) {
+	var participant Participant
+
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+
+	stub.expectError(t, ERR_BAD_ARGS, admin, "registerParticipant", `{"role":"operator"}`)
+	stub.expectError(t, ERR_BAD_ARGS, admin, "registerParticipant", `{"uid":"op1","role":"courier"}`)
+	stub.expectError(t, ERR_BAD_ARGS, admin, "registerParticipant", `{"uid":"op1","role":"operator","office":"rome"}`)
+	stub.expectError(t, ERR_BAD_ARGS, admin, "registerParticipant", `{"uid":"op1","role":"operator","org":"Org1MSP/x"}`)
+	stub.expectError(t, ERR_FORBIDDEN, operator, "registerParticipant", `{"uid":"op1","role":"operator"}`)
+	stub.register(t, admin, operator)
+	stub.mustInvoke(t, admin, "registerParticipant", `{"uid":"m2","role":"member","active":true}`)
+	stub.mustInvoke(t, admin, "registerParticipant", `{"uid":"op2","role":"operator","office":"RM01","active":false}`)
+
+	payload := stub.mustInvoke(t, admin, "getParticipantDetails", "op1")
+	json.Unmarshal(payload, &participant)
+	if participant.Org != "Org1MSP" || participant.Office != "RM01" || !participant.Active || participant.DocType != DOC_TYPE_PARTICIPANT {
+		t.Fatalf("registered participant: %+v", participant)
+	}
+	stub.expectError(t, ERR_NOT_FOUND, admin, "getParticipantDetails", "ghost")
+	stub.expectError(t, ERR_FORBIDDEN, member, "getParticipantDetails", "op1")
+
+	custodyId := stub.newChain(t, member, "T1")
+	stub.expectError(t, ERR_BAD_ARGS, member, "startTransfer", custodyId, "ghost")
+	stub.expectError(t, ERR_BAD_ARGS, member, "startTransfer", custodyId, "m2")
+	stub.expectError(t, ERR_BAD_ARGS, member, "startTransfer", custodyId, "op2")
+	stub.expectError(t, ERR_BAD_ARGS, member, "startTransfer", custodyId, "Org2MSP/op1")
+	stub.mustInvoke(t, member, "startTransfer", custodyId, "op1")
+	if pending := stub.getChain(t, custodyId).PendingCustodian; pending != operator.identity() {
+		t.Fatalf("pending custodian: %s", pending)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//QUERYBY*: rich queries on the ChainOfCustody records, they need CouchDB as state database.
+//The other records have fields with the same names, the selector matches also the docType.
+//The caller must have the same roles required by getAssetDetails!!
+//The results are filtered by the jurisdiction of the caller, see filterByJurisdiction.
+
+func (t *DcotWorkflowChaincode) queryByTrackingId(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+	return t.queryByField(stub, "queryByTrackingId", "trackingId", args)
+}
+
+func (t *DcotWorkflowChaincode) queryByDocumentId(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+	return t.queryByField(stub, "queryByDocumentId", "documentId", args)
+}
+
+func (t *DcotWorkflowChaincode) queryByDeliveryMan(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+	args, err := resolveIdentityArg(stub, args)
+	if err != nil {
+		return errorResponseFrom("queryByDeliveryMan", err)
+	}
+	return t.queryByField(stub, "queryByDeliveryMan", "custodian", args)
+}
+
+func (t *DcotWorkflowChaincode) queryByStatus(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+	return t.queryByField(stub, "queryByStatus", "status", args)
+}
+
+func (t *DcotWorkflowChaincode) queryBySortingCenter(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+	return t.queryByField(stub, "queryBySortingCenter", "sortingCenterDestination", args)
+}
+
+func (t *DcotWorkflowChaincode) queryByField(stub shim.ChaincodeStubInterface, operation string, field string, args []string) pb.Response {
+
+	logger.Debug(operation + "()")
+
+	var err error
+	var queryBytes []byte
+	var chainsOfCustody []ChainOfCustody
+	var jsonResp []byte
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, operation, "this method must want exactly one argument!!")
+	}
+	queryBytes, err = json.Marshal(map[string]interface{}{
+		"selector": map[string]string{"docType": DOC_TYPE_CHAIN, field: args[0]},
+	})
+	if err != nil {
+		logger.Error(operation + " ERROR: json.Marshal()\n")
+		return errorResponseFrom(operation, err)
+	}
+	chainsOfCustody, err = getChainsOfCustodyByQuery(stub, string(queryBytes))
+	if err != nil {
+		logger.Error(operation + " ERROR: getChainsOfCustodyByQuery()\n")
+		return errorResponseFrom(operation, err)
+	}
+	chainsOfCustody, err = filterByJurisdiction(stub, operation, chainsOfCustody)
+	if err != nil {
+		logger.Error(operation + " ERROR: filterByJurisdiction()\n")
+		return errorResponseFrom(operation, err)
+	}
+	jsonResp, err = json.Marshal(chainsOfCustody)
+	if err != nil {
+		logger.Error(operation + " ERROR: json.Marshal()\n")
+		return errorResponseFrom(operation, err)
+	}
+	logger.Debug("Query Response:\n" + string(jsonResp))
+	return shim.Success(jsonResp)
+}
+
+func getChainsOfCustodyByQuery(stub shim.ChaincodeStubInterface, query string) ([]ChainOfCustody, error) {
+
+	chainsOfCustody := []ChainOfCustody{}
+
+	resultsIterator, err := stub.GetQueryResult(query)
+	if err != nil {
+		return nil, newError(ERR_LEDGER, "", err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		var chainOfCustody ChainOfCustody
+
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, newError(ERR_LEDGER, "", err.Error())
+		}
+		err = json.Unmarshal(queryResponse.Value, &chainOfCustody)
+		if err != nil {
+			return nil, newError(ERR_CORRUPT_RECORD, "", queryResponse.Key+" can't be decoded: "+err.Error())
+		}
+		migrateChainOfCustody(&chainOfCustody)
+		chainsOfCustody = append(chainsOfCustody, chainOfCustody)
+	}
+	return chainsOfCustody, nil
+}
+
+//LOOKUPBY*: lookups on the secondary indexes, they work on every state database.
+//The caller must have the same roles required by getAssetDetails!!
+//The results are filtered like those of the QUERYBY*.
+
+func (t *DcotWorkflowChaincode) lookupByTrackingId(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+	return t.lookupByIndex(stub, "lookupByTrackingId", TRACKING_ID_INDEX, 1, args)
+}
+
+//LOOKUPBYDELIVERYMAN: args are the Custodian and optionally the status,
+//a bare UID is in the caller's organization
+
+func (t *DcotWorkflowChaincode) lookupByDeliveryMan(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+	args, err := resolveIdentityArg(stub, args)
+	if err != nil {
+		return errorResponseFrom("lookupByDeliveryMan", err)
+	}
+	return t.lookupByIndex(stub, "lookupByDeliveryMan", DELIVERY_MAN_INDEX, 2, args)
+}
+
+//LOOKUPBYOFFICE: args are the DistributionOfficeCode and optionally the DistributionZone
+
+func (t *DcotWorkflowChaincode) lookupByOffice(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+	return t.lookupByIndex(stub, "lookupByOffice", OFFICE_INDEX, 2, args)
+}
+
+func (t *DcotWorkflowChaincode) lookupByIndex(stub shim.ChaincodeStubInterface, operation string, indexName string, maxArgs int, args []string) pb.Response {
+
+	logger.Debug(operation + "()")
+
+	var err error
+	var custodyIds []string
+	var chainOfCustody *ChainOfCustody
+	var jsonResp []byte
+
+	chainsOfCustody := []ChainOfCustody{}
+
+	if len(args) < 1 || len(args) > maxArgs {
+		return errorResponse(ERR_BAD_ARGS, operation, "wrong number of arguments!!")
+	}
+	custodyIds, err = getIdsByIndex(stub, indexName, args)
+	if err != nil {
+		logger.Error(operation + " ERROR: getIdsByIndex()\n")
+		return errorResponseFrom(operation, err)
+	}
+	for _, custodyId := range custodyIds {
+		_, chainOfCustody, _, err = loadChainOfCustody(stub, custodyId)
+		if err != nil {
+			logger.Error(operation + " ERROR: loadChainOfCustody()\n")
+			return errorResponseFrom(operation, err)
+		}
+		chainsOfCustody = append(chainsOfCustody, *chainOfCustody)
+	}
+	chainsOfCustody, err = filterByJurisdiction(stub, operation, chainsOfCustody)
+	if err != nil {
+		logger.Error(operation + " ERROR: filterByJurisdiction()\n")
+		return errorResponseFrom(operation, err)
+	}
+	jsonResp, err = json.Marshal(chainsOfCustody)
+	if err != nil {
+		logger.Error(operation + " ERROR: json.Marshal()\n")
+		return errorResponseFrom(operation, err)
+	}
+	logger.Debug("Query Response:\n" + string(jsonResp))
+	return shim.Success(jsonResp)
+}
+
+//GETCUSTODYTRAIL: returns the event log of a ChainOfCustody, it doesn't need the history database.
+//The caller must have the same roles required by getAssetDetails!!
+
+func (t *DcotWorkflowChaincode) getCustodyTrail(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("getCustodyTrail()")
+
+	var err error
+	var custodyEvents []CustodyEvent
+	var jsonResp []byte
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, "getCustodyTrail", "this method must want exactly one argument!!")
+	}
+	custodyEvents, err = getCustodyEvents(stub, args[0])
+	if err != nil {
+		logger.Error("getCustodyTrail ERROR: getCustodyEvents()\n")
+		return errorResponseFrom("getCustodyTrail", err)
+	}
+	jsonResp, err = json.Marshal(custodyEvents)
+	if err != nil {
+		logger.Error("getCustodyTrail ERROR: json.Marshal()\n")
+		return errorResponseFrom("getCustodyTrail", err)
+	}
+	logger.Debug("Query Response:\n" + string(jsonResp))
+	return shim.Success(jsonResp)
+}
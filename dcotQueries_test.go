@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEveryStoredRecordHasADocType(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+	evidence := `["` + sha256Hex("photo") + `"]`
+
+	stub.register(t, admin, operator)
+	stub.mustInvoke(t, admin, "setConfig", `{"maxDeliveryAttempts":2}`)
+	custodyId := stub.newChain(t, member, "T1")
+	stub.mustInvoke(t, member, "createConsignment")
+	stub.mustInvoke(t, operator, "raiseException", custodyId, `{"status":"ON_HOLD","reason":"customs","evidenceHashes":`+evidence+`}`)
+	stub.mustInvoke(t, admin, "suspendUser", "m1")
+
+	for key, value := range stub.State {
+		var record map[string]interface{}
+
+		if json.Unmarshal(value, &record) != nil {
+			continue
+		}
+		if docType, _ := record["docType"].(string); len(docType) == 0 {
+			t.Errorf("the record %q has no docType: %s", key, string(value))
+		}
+	}
+}
+
+func TestMigrateChainsSetsTheDocType(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+
+	legacy := ChainOfCustody{Id: "legacy", TrackingId: "T1", DeliveryMan: "d1", Status: IN_CUSTODY}
+	legacyBytes, _ := json.Marshal(&legacy)
+	COCKey, _ := getCOCKey(stub, "legacy")
+	stub.MockTransactionStart("setup")
+	stub.PutState(COCKey, legacyBytes)
+	stub.MockTransactionEnd("setup")
+
+	stub.mustInvoke(t, admin, "migrateChains", "Org1MSP")
+
+	var migrated ChainOfCustody
+
+	json.Unmarshal(stub.State[COCKey], &migrated)
+	if migrated.DocType != DOC_TYPE_CHAIN || migrated.Custodian != "Org1MSP/d1" {
+		t.Fatalf("after migrateChains: docType %q, custodian %q", migrated.DocType, migrated.Custodian)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//SUSPENDUSER: args are the identity and optionally the reason, the UID can't invoke anything
+//and can't receive parcels until reinstateUser, whatever his certificate says.
+//The caller must be a Admin!!!
+
+func (t *DcotWorkflowChaincode) suspendUser(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("suspendUser()")
+
+	if len(args) != 1 && len(args) != 2 {
+		return errorResponse(ERR_BAD_ARGS, "suspendUser", "this method must want one or two arguments!!")
+	}
+	return updateRoleAssignment(stub, "suspendUser", args, func(assignment *RoleAssignment, txTime time.Time) error {
+		assignment.Suspended = true
+		return nil
+	})
+}
+
+//REINSTATEUSER: args is the UID of a suspended user
+//The caller must be a Admin!!!
+
+func (t *DcotWorkflowChaincode) reinstateUser(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("reinstateUser()")
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, "reinstateUser", "this method must want exactly one argument!!")
+	}
+	return updateRoleAssignment(stub, "reinstateUser", args, func(assignment *RoleAssignment, txTime time.Time) error {
+		if !assignment.Suspended {
+			return newError(ERR_INVALID_STATE, "reinstateUser", "the user "+assignment.UID+" is not suspended!!")
+		}
+		assignment.Suspended = false
+		return nil
+	})
+}
+
+//GRANTTEMPORARYROLE: args are the UID, the role and the RFC3339 time when it expires,
+//until then the permission matrix gives the UID also the operations of that role.
+//Granting again the same role replaces its expiry.
+//The caller must be a Admin!!!
+
+func (t *DcotWorkflowChaincode) grantTemporaryRole(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("grantTemporaryRole()")
+
+	if len(args) != 3 {
+		return errorResponse(ERR_BAD_ARGS, "grantTemporaryRole", "this method must want exactly three arguments!!")
+	}
+	if !containsString(allRoles, args[1]) {
+		return errorResponse(ERR_BAD_ARGS, "grantTemporaryRole", "unknown role "+args[1]+"!!")
+	}
+	expiresAt, err := time.Parse(time.RFC3339, args[2])
+	if err != nil {
+		return errorResponse(ERR_BAD_ARGS, "grantTemporaryRole", "the expiry must be a RFC3339 time!!")
+	}
+	return updateRoleAssignment(stub, "grantTemporaryRole", args, func(assignment *RoleAssignment, txTime time.Time) error {
+		if !expiresAt.After(txTime) {
+			return newError(ERR_BAD_ARGS, "grantTemporaryRole", "the expiry must be in the future!!")
+		}
+		assignment.TemporaryRoles = removeTemporaryRole(assignment.TemporaryRoles, args[1])
+		assignment.TemporaryRoles = append(assignment.TemporaryRoles, TemporaryRole{args[1], expiresAt.UTC().Format(time.RFC3339)})
+		return nil
+	})
+}
+
+//REVOKETEMPORARYROLE: args are the UID and the temporary role to revoke before its expiry
+//The caller must be a Admin!!!
+
+func (t *DcotWorkflowChaincode) revokeTemporaryRole(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("revokeTemporaryRole()")
+
+	if len(args) != 2 {
+		return errorResponse(ERR_BAD_ARGS, "revokeTemporaryRole", "this method must want exactly two arguments!!")
+	}
+	return updateRoleAssignment(stub, "revokeTemporaryRole", args, func(assignment *RoleAssignment, txTime time.Time) error {
+		temporaryRoles := removeTemporaryRole(assignment.TemporaryRoles, args[1])
+		if len(temporaryRoles) == len(assignment.TemporaryRoles) {
+			return newError(ERR_NOT_FOUND, "revokeTemporaryRole", "the user "+assignment.UID+" has not the temporary role "+args[1]+"!!")
+		}
+		assignment.TemporaryRoles = temporaryRoles
+		return nil
+	})
+}
+
+//OVERRIDEROLE: args are the UID and the role that replaces the one of his certificate,
+//an empty role removes the override.
+//The caller must be a Admin!!!
+
+func (t *DcotWorkflowChaincode) overrideRole(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("overrideRole()")
+
+	if len(args) != 2 {
+		return errorResponse(ERR_BAD_ARGS, "overrideRole", "this method must want exactly two arguments!!")
+	}
+	if len(args[1]) != 0 && !containsString(allRoles, args[1]) {
+		return errorResponse(ERR_BAD_ARGS, "overrideRole", "unknown role "+args[1]+"!!")
+	}
+	return updateRoleAssignment(stub, "overrideRole", args, func(assignment *RoleAssignment, txTime time.Time) error {
+		assignment.RoleOverride = args[1]
+		return nil
+	})
+}
+
+//GETROLEASSIGNMENTDETAILS: args is the UID
+//The caller must be a Admin!!!
+
+func (t *DcotWorkflowChaincode) getRoleAssignmentDetails(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("getRoleAssignmentDetails()")
+
+	var err error
+	var callerUID, identity string
+	var assignment *RoleAssignment
+	var assignmentBytes []byte
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, "getRoleAssignmentDetails", "this method must want exactly one argument!!")
+	}
+	_, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("getRoleAssignmentDetails ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("getRoleAssignmentDetails", err)
+	}
+	identity = resolveIdentity(callerUID, args[0])
+	assignment, err = getRoleAssignment(stub, identity)
+	if err != nil {
+		logger.Error("getRoleAssignmentDetails ERROR: getRoleAssignment()\n")
+		return errorResponseFrom("getRoleAssignmentDetails", err)
+	}
+	if assignment == nil {
+		return errorResponse(ERR_NOT_FOUND, "getRoleAssignmentDetails", "the user "+identity+" has no role assignment!!")
+	}
+	assignmentBytes, err = json.Marshal(assignment)
+	if err != nil {
+		logger.Error("getRoleAssignmentDetails ERROR: json.Marshal()\n")
+		return errorResponseFrom("getRoleAssignmentDetails", err)
+	}
+	logger.Debug("Query Response:\n" + string(assignmentBytes))
+	return shim.Success(assignmentBytes)
+}
+
+//GETROLEAUDIT: args is the UID, returns every change of his RoleAssignment in order
+//The caller must be a Admin!!!
+
+func (t *DcotWorkflowChaincode) getRoleAudit(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("getRoleAudit()")
+
+	var err error
+	var callerUID string
+	var jsonResp []byte
+
+	auditEntries := []RoleAuditEntry{}
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, "getRoleAudit", "this method must want exactly one argument!!")
+	}
+	_, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error("getRoleAudit ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("getRoleAudit", err)
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(ROLE_AUDIT_KEY, []string{resolveIdentity(callerUID, args[0])})
+	if err != nil {
+		logger.Error("getRoleAudit ERROR: GetStateByPartialCompositeKey()\n")
+		return errorResponse(ERR_LEDGER, "getRoleAudit", err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		var auditEntry RoleAuditEntry
+
+		auditResult, err := resultsIterator.Next()
+		if err != nil {
+			logger.Error("getRoleAudit ERROR: resultsIterator.Next()\n")
+			return errorResponse(ERR_LEDGER, "getRoleAudit", err.Error())
+		}
+		err = json.Unmarshal(auditResult.Value, &auditEntry)
+		if err != nil {
+			logger.Error("getRoleAudit ERROR: json.Unmarshal()\n")
+			return errorResponse(ERR_CORRUPT_RECORD, "getRoleAudit", err.Error())
+		}
+		auditEntries = append(auditEntries, auditEntry)
+	}
+	jsonResp, err = json.Marshal(auditEntries)
+	if err != nil {
+		logger.Error("getRoleAudit ERROR: json.Marshal()\n")
+		return errorResponseFrom("getRoleAudit", err)
+	}
+	logger.Debug("Query Response:\n" + string(jsonResp))
+	return shim.Success(jsonResp)
+}
+
+//UPDATEROLEASSIGNMENT: common part of the operations changing the RoleAssignment of args[0],
+//a MSPID/UID identity or a bare UID of the caller's organization, it's created on the first change. The expired temporary roles are dropped and the change is audited.
+//An administrator can't change his own RoleAssignment, so he can't lock himself out.
+
+func updateRoleAssignment(stub shim.ChaincodeStubInterface, operation string, args []string, change func(*RoleAssignment, time.Time) error) pb.Response {
+
+	var err error
+	var callerRole, callerUID string
+	var identity string
+	var assignment *RoleAssignment
+	var previous *RoleAssignment
+	var assignmentKey string
+	var assignmentBytes []byte
+	var txTime time.Time
+
+	if len(args[0]) == 0 {
+		return errorResponse(ERR_BAD_ARGS, operation, "UID must not be empty!!")
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		logger.Error(operation + " ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom(operation, err)
+	}
+	identity = resolveIdentity(callerUID, args[0])
+	if identity == callerUID {
+		logger.Error(operation + " ERROR: the caller can't change his own role assignment!!\n")
+		return errorResponse(ERR_FORBIDDEN, operation, "the caller can't change his own role assignment!!")
+	}
+	err = checkAdminOrg(stub, operation, callerUID, identity)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom(operation, err)
+	}
+	assignmentKey, err = getRoleAssignmentKey(stub, identity)
+	if err != nil {
+		return errorResponse(ERR_BAD_ARGS, operation, err.Error())
+	}
+	assignment, err = getRoleAssignment(stub, identity)
+	if err != nil {
+		logger.Error(operation + " ERROR: getRoleAssignment()\n")
+		return errorResponseFrom(operation, err)
+	}
+	if assignment == nil {
+		assignment = &RoleAssignment{UID: identity}
+	} else {
+		stored := *assignment
+		previous = &stored
+	}
+	txTime, err = getTxTime(stub)
+	if err != nil {
+		logger.Error(operation + " ERROR: getTxTime()\n")
+		return errorResponseFrom(operation, err)
+	}
+	err = change(assignment, txTime)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom(operation, err)
+	}
+	assignment.DocType = DOC_TYPE_ROLE_ASSIGNMENT
+	assignment.TemporaryRoles = dropExpiredRoles(assignment.TemporaryRoles, txTime)
+	assignment.Event, err = createEvent(stub, callerUID, callerRole, operation)
+	if err != nil {
+		logger.Error(operation + " ERROR: createEvent()\n")
+		return errorResponseFrom(operation, err)
+	}
+	err = appendRoleAudit(stub, previous, assignment, args)
+	if err != nil {
+		logger.Error(operation + " ERROR: appendRoleAudit()\n")
+		return errorResponseFrom(operation, err)
+	}
+	assignmentBytes, err = json.Marshal(assignment)
+	if err != nil {
+		logger.Error(operation + " ERROR: json.Marshal()\n")
+		return errorResponseFrom(operation, err)
+	}
+	err = stub.PutState(assignmentKey, assignmentBytes)
+	if err != nil {
+		logger.Error(operation + " ERROR: PutState()\n")
+		return errorResponse(ERR_LEDGER, operation, err.Error())
+	}
+	err = stub.SetEvent(operation+" EVENT: ", assignmentBytes)
+	if err != nil {
+		logger.Error(operation + " ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, operation, err.Error())
+	}
+	logger.Info(operation+" EVENT: ", string(assignmentBytes))
+	return shim.Success(assignmentBytes)
+}
+
+//APPENDROLEAUDIT: must be called after current.Event is set and before current is stored,
+//because it increments current.AuditCount. previous is nil for a new RoleAssignment.
+
+func appendRoleAudit(stub shim.ChaincodeStubInterface, previous *RoleAssignment, current *RoleAssignment, args []string) error {
+	var auditEntry RoleAuditEntry
+
+	auditEntry.DocType = DOC_TYPE_ROLE_AUDIT
+	auditEntry.UID = current.UID
+	auditEntry.Seq = current.AuditCount
+	auditEntry.Previous = previous
+	auditEntry.Current = *current
+	auditEntry.Args = args
+	auditEntry.Event = current.Event
+
+	auditKey, err := stub.CreateCompositeKey(ROLE_AUDIT_KEY, []string{current.UID, fmt.Sprintf("%010d", auditEntry.Seq)})
+	if err != nil {
+		return err
+	}
+	auditBytes, err := json.Marshal(&auditEntry)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(auditKey, auditBytes)
+	if err != nil {
+		return newError(ERR_LEDGER, "", err.Error())
+	}
+	current.AuditCount++
+	return nil
+}
+
+//GETROLEASSIGNMENT: returns nil if the UID has no RoleAssignment
+
+func getRoleAssignment(stub shim.ChaincodeStubInterface, uid string) (*RoleAssignment, error) {
+	var assignment RoleAssignment
+
+	assignmentKey, err := getRoleAssignmentKey(stub, uid)
+	if err != nil {
+		return nil, newError(ERR_BAD_ARGS, "", err.Error())
+	}
+	err = loadRecord(stub, assignmentKey, "RoleAssignment", uid, &assignment)
+	if err != nil {
+		if chaincodeError, ok := err.(*ErrorResponse); ok && chaincodeError.Code == ERR_NOT_FOUND {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &assignment, nil
+}
+
+//GETEFFECTIVEROLES: applies the RoleAssignment of uid to baseRole, the role of the certificate
+//or of the registry: the override replaces it and the temporary roles not expired follow it.
+//suspended is true if the UID is suspended.
+
+func getEffectiveRoles(stub shim.ChaincodeStubInterface, uid string, baseRole string) ([]string, bool, error) {
+
+	assignment, err := getRoleAssignment(stub, uid)
+	if err != nil {
+		return nil, false, err
+	}
+	if assignment == nil {
+		return []string{baseRole}, false, nil
+	}
+	if len(assignment.RoleOverride) != 0 {
+		baseRole = assignment.RoleOverride
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return nil, false, err
+	}
+	effectiveRoles := []string{baseRole}
+	for _, temporaryRole := range dropExpiredRoles(assignment.TemporaryRoles, txTime) {
+		effectiveRoles = append(effectiveRoles, temporaryRole.Role)
+	}
+	return effectiveRoles, assignment.Suspended, nil
+}
+
+func dropExpiredRoles(temporaryRoles []TemporaryRole, txTime time.Time) []TemporaryRole {
+	var activeRoles []TemporaryRole
+
+	for _, temporaryRole := range temporaryRoles {
+		expiresAt, err := time.Parse(time.RFC3339, temporaryRole.ExpiresAt)
+		if err == nil && txTime.Before(expiresAt) {
+			activeRoles = append(activeRoles, temporaryRole)
+		}
+	}
+	return activeRoles
+}
+
+func removeTemporaryRole(temporaryRoles []TemporaryRole, role string) []TemporaryRole {
+	var remainingRoles []TemporaryRole
+
+	for _, temporaryRole := range temporaryRoles {
+		if temporaryRole.Role != role {
+			remainingRoles = append(remainingRoles, temporaryRole)
+		}
+	}
+	return remainingRoles
+}
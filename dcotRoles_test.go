@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSuspendedUsersCanNeitherInvokeNorReceive(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+
+	stub.register(t, admin, operator)
+	custodyId := stub.newChain(t, member, "T1")
+	stub.expectError(t, ERR_FORBIDDEN, admin, "suspendUser", "adm")
+	stub.expectError(t, ERR_INVALID_STATE, admin, "reinstateUser", "m1")
+
+	stub.mustInvoke(t, admin, "suspendUser", "m1", "lost badge")
+	stub.expectError(t, ERR_FORBIDDEN, member, "startTransfer", custodyId, "op1")
+	stub.mustInvoke(t, admin, "reinstateUser", "m1")
+
+	stub.mustInvoke(t, admin, "suspendUser", "op1")
+	stub.expectError(t, ERR_BAD_ARGS, member, "startTransfer", custodyId, "op1")
+	stub.mustInvoke(t, admin, "reinstateUser", "op1")
+	stub.mustInvoke(t, member, "startTransfer", custodyId, "op1")
+	stub.mustInvoke(t, operator, "completeTrasfer", custodyId)
+}
+
+func TestTemporaryRolesAndOverridesChangeTheEffectiveRole(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+
+	stub.expectError(t, ERR_FORBIDDEN, member, "setConfig", `{}`)
+	stub.expectError(t, ERR_BAD_ARGS, admin, "grantTemporaryRole", "m1", "pilot", stub.now.Add(time.Hour).Format(time.RFC3339))
+	stub.expectError(t, ERR_BAD_ARGS, admin, "grantTemporaryRole", "m1", CALLER_ROLE_1, stub.now.Add(-time.Hour).Format(time.RFC3339))
+	stub.mustInvoke(t, admin, "grantTemporaryRole", "m1", CALLER_ROLE_1, stub.now.Add(time.Hour).Format(time.RFC3339))
+	stub.mustInvoke(t, member, "setConfig", `{}`)
+	stub.now = stub.now.Add(2 * time.Hour)
+	stub.expectError(t, ERR_FORBIDDEN, member, "setConfig", `{}`)
+
+	stub.mustInvoke(t, admin, "overrideRole", "m1", CALLER_ROLE_1)
+	stub.mustInvoke(t, member, "setConfig", `{}`)
+	stub.mustInvoke(t, admin, "overrideRole", "m1", "")
+	stub.expectError(t, ERR_FORBIDDEN, member, "setConfig", `{}`)
+	stub.expectError(t, ERR_NOT_FOUND, admin, "revokeTemporaryRole", "m1", CALLER_ROLE_2)
+}
+
+func TestRoleAuditKeepsEveryChange(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+
+	stub.expectError(t, ERR_NOT_FOUND, admin, "getRoleAssignmentDetails", "m1")
+	stub.mustInvoke(t, admin, "suspendUser", "m1")
+	stub.mustInvoke(t, admin, "reinstateUser", "m1")
+	stub.mustInvoke(t, admin, "overrideRole", "m1", CALLER_ROLE_2)
+
+	var entries []RoleAuditEntry
+	if err := json.Unmarshal(stub.mustInvoke(t, admin, "getRoleAudit", "m1"), &entries); err != nil {
+		t.Fatalf("getRoleAudit: %s", err.Error())
+	}
+	if len(entries) != 3 {
+		t.Fatalf("audit entries: %+v", entries)
+	}
+	if entries[0].Previous != nil || !entries[0].Current.Suspended {
+		t.Fatalf("first audit entry: %+v", entries[0])
+	}
+	for i, entry := range entries {
+		if entry.Seq != i {
+			t.Fatalf("audit entry %d has seq %d", i, entry.Seq)
+		}
+	}
+	if !entries[1].Previous.Suspended || entries[1].Current.Suspended || entries[2].Current.RoleOverride != CALLER_ROLE_2 {
+		t.Fatalf("audit entries: %+v", entries)
+	}
+
+	var assignment RoleAssignment
+	if err := json.Unmarshal(stub.mustInvoke(t, admin, "getRoleAssignmentDetails", "m1"), &assignment); err != nil {
+		t.Fatalf("getRoleAssignmentDetails: %s", err.Error())
+	}
+	if assignment.AuditCount != 3 || assignment.RoleOverride != CALLER_ROLE_2 {
+		t.Fatalf("role assignment: %+v", assignment)
+	}
+}
@@ -6,7 +6,6 @@ import (
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
-	"github.com/rs/xid"
 )
 
 var logger = shim.NewLogger("dcot-chaincode-log")
@@ -19,11 +18,16 @@ func (t *DcotWorkflowChaincode) Init(stub shim.ChaincodeStubInterface) pb.Respon
 
 	logger.Info("Initializing Chain of Custody")
 	logger.SetLevel(shim.LogDebug)
-	_, args := stub.GetFunctionAndParameters()
+	function, args := stub.GetFunctionAndParameters()
 
-	if len(args) == 0 {
-		//logger.Info("Args correctly!!!")
-		return shim.Success(nil)
+	//the configuration is given as {"Args":["config","<json of the ChaincodeConfig>"]},
+	//any other argument is ignored
+	if function == INIT_CONFIG_KEY && len(args) == 1 {
+		_, err := putConfig(stub, args[0])
+		if err != nil {
+			logger.Error("Init ERROR: putConfig()\n")
+			return errorResponseFrom("Init", err)
+		}
 	}
 
 	return shim.Success(nil)
@@ -41,23 +45,30 @@ func (t *DcotWorkflowChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Resp
 		creatorOrg, creatorCertIssuer, err = getTxCreatorInfo(stub)
 		if err != nil {
 			logger.Error("Error extracting creator identity info: \n", err.Error())
-			return shim.Error(err.Error())
+			return errorResponseFrom("Invoke", err)
 		}
 		logger.Info("DcotWorkflow Invoke by '', ''\n", creatorOrg, creatorCertIssuer)
 		callerRole, _, err = getTxCreatorInfo(stub)
 		if err != nil {
-			return shim.Error(err.Error())
+			return errorResponseFrom("Invoke", err)
 		}
 
 		isEnabled, _, err = isInvokerOperator(stub, callerRole)
 		if err != nil {
 			logger.Error("Error getting attribute info: \n", err.Error())
-			return shim.Error(err.Error())
+			return errorResponseFrom("Invoke", err)
 		}
 	}
 
 	function, args := stub.GetFunctionAndParameters()
 
+	//the permission matrix is evaluated before the dispatch, see permissionPolicy.go
+	err = checkPermission(stub, function, args)
+	if err != nil {
+		logger.Error("Invoke ERROR: checkPermission() " + function + "\n")
+		return errorResponseFrom(function, err)
+	}
+
 	if function == "initNewChain" {
 		return t.initNewChain(stub, isEnabled, args)
 	} else if function == "startTransfer" {
@@ -68,6 +79,8 @@ func (t *DcotWorkflowChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Resp
 		return t.commentChain(stub, isEnabled, args)
 	} else if function == "cancelTrasfer" {
 		return t.cancelTrasfer(stub, isEnabled, args)
+	} else if function == "rejectTransfer" {
+		return t.rejectTransfer(stub, isEnabled, args)
 	} else if function == "terminateChain" {
 		return t.terminateChain(stub, isEnabled, args)
 	} else if function == "updateDocument" {
@@ -76,11 +89,104 @@ func (t *DcotWorkflowChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Resp
 		return t.getAssetDetails(stub, isEnabled, args)
 	} else if function == "getChainOfEvents" {
 		return t.getChainOfEvents(stub, isEnabled, args)
-	}
-	return shim.Error("Invalid invoke function name")
+	} else if function == "queryByTrackingId" {
+		return t.queryByTrackingId(stub, isEnabled, args)
+	} else if function == "queryByDocumentId" {
+		return t.queryByDocumentId(stub, isEnabled, args)
+	} else if function == "queryByDeliveryMan" {
+		return t.queryByDeliveryMan(stub, isEnabled, args)
+	} else if function == "queryByStatus" {
+		return t.queryByStatus(stub, isEnabled, args)
+	} else if function == "queryBySortingCenter" {
+		return t.queryBySortingCenter(stub, isEnabled, args)
+	} else if function == "lookupByTrackingId" {
+		return t.lookupByTrackingId(stub, isEnabled, args)
+	} else if function == "lookupByDeliveryMan" {
+		return t.lookupByDeliveryMan(stub, isEnabled, args)
+	} else if function == "lookupByOffice" {
+		return t.lookupByOffice(stub, isEnabled, args)
+	} else if function == "getCustodyTrail" {
+		return t.getCustodyTrail(stub, isEnabled, args)
+	} else if function == "migrateChains" {
+		return t.migrateChains(stub, isEnabled, args)
+	} else if function == "registerParticipant" {
+		return t.registerParticipant(stub, isEnabled, args)
+	} else if function == "getParticipantDetails" {
+		return t.getParticipantDetails(stub, isEnabled, args)
+	} else if function == "expirePendingTransfers" {
+		return t.expirePendingTransfers(stub, isEnabled, args)
+	} else if function == "initNewChainBatch" {
+		return t.initNewChainBatch(stub, isEnabled, args)
+	} else if function == "startTransferBatch" {
+		return t.startTransferBatch(stub, isEnabled, args)
+	} else if function == "completeTransferBatch" {
+		return t.completeTransferBatch(stub, isEnabled, args)
+	} else if function == "createConsignment" {
+		return t.createConsignment(stub, isEnabled, args)
+	} else if function == "addToConsignment" {
+		return t.addToConsignment(stub, isEnabled, args)
+	} else if function == "removeFromConsignment" {
+		return t.removeFromConsignment(stub, isEnabled, args)
+	} else if function == "startConsignmentTransfer" {
+		return t.startConsignmentTransfer(stub, isEnabled, args)
+	} else if function == "completeConsignmentTransfer" {
+		return t.completeConsignmentTransfer(stub, isEnabled, args)
+	} else if function == "cancelConsignmentTransfer" {
+		return t.cancelConsignmentTransfer(stub, isEnabled, args)
+	} else if function == "rejectConsignmentTransfer" {
+		return t.rejectConsignmentTransfer(stub, isEnabled, args)
+	} else if function == "closeConsignment" {
+		return t.closeConsignment(stub, isEnabled, args)
+	} else if function == "getConsignmentDetails" {
+		return t.getConsignmentDetails(stub, isEnabled, args)
+	} else if function == "splitChain" {
+		return t.splitChain(stub, isEnabled, args)
+	} else if function == "mergeChains" {
+		return t.mergeChains(stub, isEnabled, args)
+	} else if function == "getLineage" {
+		return t.getLineage(stub, isEnabled, args)
+	} else if function == "deliverParcel" {
+		return t.deliverParcel(stub, isEnabled, args)
+	} else if function == "recordDeliveryAttempt" {
+		return t.recordDeliveryAttempt(stub, isEnabled, args)
+	} else if function == "completeReturn" {
+		return t.completeReturn(stub, isEnabled, args)
+	} else if function == "setConfig" {
+		return t.setConfig(stub, isEnabled, args)
+	} else if function == "raiseException" {
+		return t.raiseException(stub, isEnabled, args)
+	} else if function == "resolveInvestigation" {
+		return t.resolveInvestigation(stub, isEnabled, args)
+	} else if function == "getInvestigations" {
+		return t.getInvestigations(stub, isEnabled, args)
+	} else if function == "suspendUser" {
+		return t.suspendUser(stub, isEnabled, args)
+	} else if function == "reinstateUser" {
+		return t.reinstateUser(stub, isEnabled, args)
+	} else if function == "grantTemporaryRole" {
+		return t.grantTemporaryRole(stub, isEnabled, args)
+	} else if function == "revokeTemporaryRole" {
+		return t.revokeTemporaryRole(stub, isEnabled, args)
+	} else if function == "overrideRole" {
+		return t.overrideRole(stub, isEnabled, args)
+	} else if function == "getRoleAssignmentDetails" {
+		return t.getRoleAssignmentDetails(stub, isEnabled, args)
+	} else if function == "getRoleAudit" {
+		return t.getRoleAudit(stub, isEnabled, args)
+	} else if function == "grantDelegation" {
+		return t.grantDelegation(stub, isEnabled, args)
+	} else if function == "revokeDelegation" {
+		return t.revokeDelegation(stub, isEnabled, args)
+	} else if function == "getDelegations" {
+		return t.getDelegations(stub, isEnabled, args)
+	}
+	return errorResponse(ERR_UNKNOWN_FUNCTION, function, "Invalid invoke function name")
 }
 
-//INITNEWCHAIN: the input json must contain the DocumentID,
+//INITNEWCHAIN: the input json may contain only the NEW_CHAIN_FIELDS, TrackingId, DocumentId,
+//a positive WeightOfParcel, SortingCenterDestination and DistributionOfficeCode are required,
+//an optional second argument is the client's idempotency key,
+//the optional OTP required by deliverParcel is in the transient data under the 'otp' key with its salt under 'otpSalt'.
 //The caller must be a MEMBER/ADMIN!!!
 //Custodian is the member UID!!!
 
@@ -94,67 +200,82 @@ func (t *DcotWorkflowChaincode) initNewChain(stub shim.ChaincodeStubInterface, i
 	var COCKey string
 	var callerRole, callerUID string
 	var operation string
-	var event Event
+	var custodyId, idempotencyKey string
+	var otp string
+	var exists bool
+	var fieldErrors []FieldError
 
-	guid := xid.New()
-	COCKey, err = getCOCKey(stub, guid.String())
-	if err != nil {
-		return shim.Error(err.Error())
+	if len(args) != 1 && len(args) != 2 {
+		return errorResponse(ERR_BAD_ARGS, "initNewChain", "this method must want one or two arguments!!")
 	}
-	err = json.Unmarshal([]byte(args[0]), &chainOfCustody)
-	if err != nil {
-		return shim.Error(err.Error())
+	if len(args) == 2 {
+		idempotencyKey = args[1]
 	}
-	if chainOfCustody.DocumentId == "" || len(chainOfCustody.DocumentId) == 0 {
-		logger.Error("initNewChain ERROR: Document ID must not be null or empty string!\n")
-		return shim.Error("initNewChain ERROR: Document ID must not be null or empty string!!\n")
-	}
-	chainOfCustody.Id = guid.String()
-	chainOfCustody.Status = IN_CUSTODY
-	operation = "initNewChain"
 	callerRole, callerUID, err = getTxCreatorInfo(stub)
 	if err != nil {
 		logger.Error("initNewChain ERROR: getTxCreatorInfo()...\n")
-		return shim.Error(err.Error())
+		return errorResponseFrom("initNewChain", err)
 	}
-	if callerRole != CALLER_ROLE_0 && callerRole != CALLER_ROLE_1 {
-		logger.Error("initNewChain ERROR: the user's role must be a member or administrator!\n")
-		return shim.Error("initNewChain ERROR: the user's role must be a member CALLER_ROLE_1\n")
+	custodyId = generateCustodyId(stub, "initNewChain", callerUID, idempotencyKey, 0)
+	COCKey, err = getCOCKey(stub, custodyId)
+	if err != nil {
+		return errorResponseFrom("initNewChain", err)
 	}
-	if len(callerUID) == 0 {
-		logger.Error("initNewChain ERROR: caller_UID is empty!!!\n")
-		return shim.Error("initNewChain ERROR: caller_UID is empty!!!\n")
+	exists, err = recordExists(stub, COCKey)
+	if err != nil {
+		logger.Error("initNewChain ERROR: recordExists()\n")
+		return errorResponseFrom("initNewChain", err)
+	}
+	if exists {
+		logger.Error("initNewChain ERROR: ChainOfCustody " + custodyId + " already exists!!\n")
+		return errorResponse(ERR_ALREADY_EXISTS, "initNewChain", "ChainOfCustody "+custodyId+" already exists!!")
 	}
-	chainOfCustody.DeliveryMan = string(callerUID)
-	event, err = createEvent(stub, callerUID, callerRole, operation)
+	chainOfCustody, fieldErrors = decodeChainOfCustody([]byte(args[0]), NEW_CHAIN_FIELDS, NEW_CHAIN_REQUIRED_FIELDS)
+	if len(fieldErrors) != 0 {
+		logger.Error("initNewChain ERROR: the ChainOfCustody is not valid!!\n")
+		return errorResponseWithDetails(ERR_BAD_ARGS, "initNewChain", "the ChainOfCustody is not valid!!", fieldErrors)
+	}
+	chainOfCustody.Id = custodyId
+	operation = "initNewChain"
+	otp, err = getTransientOtp(stub)
 	if err != nil {
-		logger.Error("initNewChain ERROR: createEvent()\n")
-		return shim.Error(err.Error())
+		logger.Error("initNewChain ERROR: GetTransient()\n")
+		return errorResponseFrom("initNewChain", err)
 	}
-	chainOfCustody.Event = event
-	byteCOC, err = json.Marshal(&chainOfCustody)
+	err = setDeliveryOtp(stub, &chainOfCustody, otp)
 	if err != nil {
-		logger.Error("initNewChain ERROR: json.Marshal()\n")
-		return shim.Error(err.Error())
+		logger.Error("initNewChain ERROR: setDeliveryOtp()\n")
+		return errorResponseFrom("initNewChain", err)
+	}
+	chainOfCustody.Status, err = applyTransition(operation, NO_CHAIN)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("initNewChain", err)
+	}
+	if len(callerUID) == 0 {
+		logger.Error("initNewChain ERROR: caller_UID is empty!!!\n")
+		return errorResponse(ERR_FORBIDDEN, "initNewChain", "caller_UID is empty!!!")
 	}
-	err = stub.PutState(COCKey, byteCOC)
+	byteCOC, err = storeNewChainOfCustody(stub, COCKey, &chainOfCustody, operation, callerUID, callerUID, callerRole, args)
 	if err != nil {
-		logger.Error("initNewChain ERROR: PutState()\n")
-		return shim.Error(err.Error())
+		logger.Error("initNewChain ERROR: storeNewChainOfCustody()\n")
+		return errorResponseFrom("initNewChain", err)
 	}
 	jsonResp = string(byteCOC)
 	logger.Info("Query Response:\n", jsonResp)
 	err = stub.SetEvent("initNewChain EVENT: ", byteCOC)
 	if err != nil {
 		logger.Error("initNewChain ERROR: SetEvent()\n")
-		return shim.Error(err.Error())
+		return errorResponse(ERR_LEDGER, "initNewChain", err.Error())
 	}
 	logger.Info("initNewChain EVENT: ", string(byteCOC))
 	return shim.Success([]byte(jsonResp))
 }
 
 //STARTTRASFER: ChainOfCustody must exist and have 'IN_CUSTODY' status,
-//the caller must be the current custodian(Delivery_Man)
+//the caller must be the current custodian, args[1] becomes the PendingCustodian,
+//it's a MSPID/UID identity or a bare UID of the caller's organization,
+//the optional args[2] is the RFC3339 deadline after which the transfer can be expired
 
 func (t *DcotWorkflowChaincode) startTransfer(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
 
@@ -162,78 +283,56 @@ func (t *DcotWorkflowChaincode) startTransfer(stub shim.ChaincodeStubInterface,
 
 	var COCKey string
 	var err error
-	var chainOfCustody ChainOfCustody
-	var chainOfCustodyBytes []byte
+	var chainOfCustody *ChainOfCustody
 	var byteCOC []byte
 	var callerRole, callerUID string
 	var operation string
-	var event Event
+	var previous ChainOfCustody
+	var deadline string
 
-	if len(args) != 2 {
-		logger.Error("startTransfer ERROR: this method must want exactly two arguments!!\n")
-		return shim.Error("startTransfer ERROR: this method must want exactly two arguments!!")
+	if len(args) != 2 && len(args) != 3 {
+		logger.Error("startTransfer ERROR: this method must want two or three arguments!!\n")
+		return errorResponse(ERR_BAD_ARGS, "startTransfer", "this method must want two or three arguments!!")
 	}
 	callerRole, callerUID, err = getTxCreatorInfo(stub)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponseFrom("startTransfer", err)
 	}
 	//if callerRole == CALLER_ROLE_1 {
 	//	logger.Error("startTransfer ERROR: Access denied for a Admin!!\n")
-	//	return shim.Error("startTransfer ERROR: Access denied for a Admin!!!")
+	//	return errorResponse(ERR_FORBIDDEN, "startTransfer", "Access denied for a Admin!!!")
 	//}
 
-	COCKey, err = getCOCKey(stub, args[0])
+	COCKey, chainOfCustody, previous, err = loadChainOfCustody(stub, args[0])
 	if err != nil {
-		logger.Error("startTransfer ERROR: getCOCKey()\n")
-		return shim.Error(err.Error())
-	}
-	chainOfCustodyBytes, err = stub.GetState(COCKey)
-	if err != nil {
-		logger.Error("startTransfer ERROR: GetState()")
-		return shim.Error(err.Error())
-	}
-	err = json.Unmarshal([]byte(chainOfCustodyBytes), &chainOfCustody)
-	if err != nil {
-		logger.Error("startTransfer ERROR: json.Unmarshal()\n")
-		return shim.Error(err.Error())
-	}
-	logger.Debug(string(chainOfCustodyBytes))
-	if callerUID != chainOfCustody.DeliveryMan {
-		logger.Error("startTransfer ERROR : The caller must be the current custodian!!\n")
-		return shim.Error("startTransfer ERROR : The caller must be the current custodian!!")
-	}
-	if chainOfCustody.Status != IN_CUSTODY {
-		logger.Error("startTransfer ERROR: Asset have not status IN_CUSTODY!!!\n")
-		return shim.Error("startTransfer ERROR : Asset have not status IN_CUSTODY!!\n")
+		logger.Error("startTransfer ERROR: loadChainOfCustody()\n")
+		return errorResponseFrom("startTransfer", err)
 	}
 	operation = "startTransfer"
-	chainOfCustody.Status = TRANSFER_PENDING
-	chainOfCustody.DeliveryMan = args[1]
-	event, err = createEvent(stub, callerUID, callerRole, operation)
-	if err != nil {
-		return shim.Error(err.Error())
+	if len(args) == 3 {
+		deadline = args[2]
 	}
-
-	chainOfCustody.Event = event
-	logger.Info("startTransferAsset: New DeliveryMan: \n", chainOfCustody.DeliveryMan)
-	byteCOC, err = json.Marshal(&chainOfCustody)
+	err = prepareStartTransfer(stub, chainOfCustody, callerUID, callerRole, args[1], deadline, "")
 	if err != nil {
-		return shim.Error(err.Error())
+		logger.Error(err.Error())
+		return errorResponseFrom("startTransfer", err)
 	}
-	err = stub.PutState(COCKey, byteCOC)
+	logger.Info("startTransferAsset: New PendingCustodian: \n", chainOfCustody.PendingCustodian)
+	byteCOC, err = storeChainOfCustody(stub, COCKey, &previous, chainOfCustody, operation, callerUID, callerRole, args)
 	if err != nil {
-		return shim.Error(err.Error())
+		logger.Error("startTransfer ERROR: storeChainOfCustody()\n")
+		return errorResponseFrom("startTransfer", err)
 	}
 	err = stub.SetEvent("startTransfer EVENT: ", byteCOC)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(ERR_LEDGER, "startTransfer", err.Error())
 	}
 	logger.Info("startTransfer EVENT: ", string(byteCOC))
 	return shim.Success(nil)
 }
 
 //COMPLETETRASFER: ChainOfCustody must exist and have 'TRANSFER_PENDING' status,
-//The caller must be a new designed receiver(Delivery_Man)
+//The caller must be a new designed receiver(PendingCustodian)
 
 func (t *DcotWorkflowChaincode) completeTrasfer(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
 
@@ -242,75 +341,41 @@ func (t *DcotWorkflowChaincode) completeTrasfer(stub shim.ChaincodeStubInterface
 	var COCKey string
 	var err error
 	var chainOfCustody *ChainOfCustody
-	var chainOfCustodyBytes []byte
 	var byteCOC []byte
 	var callerRole, callerUID string
 	var operation string
-	var event Event
+	var previous ChainOfCustody
 
 	if len(args) != 1 {
-		return shim.Error("completeTrasfer ERROR: this method must want exactly one argument!!")
+		return errorResponse(ERR_BAD_ARGS, "completeTrasfer", "this method must want exactly one argument!!")
 	}
 	callerRole, callerUID, err = getTxCreatorInfo(stub)
 	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if callerRole == CALLER_ROLE_0 || callerRole == CALLER_ROLE_1 {
-		logger.Error("completeTrasfer ERROR: Access denied for a member or an admin!!")
-		return shim.Error("completeTrasfer ERROR: Access denied for a member or an admin!!")
-	}
-
-	COCKey, err = getCOCKey(stub, args[0])
-	if err != nil {
-		logger.Error("completeTrasfer ERROR: getCOCKey()\n")
-		return shim.Error(err.Error())
+		return errorResponseFrom("completeTrasfer", err)
 	}
 
-	chainOfCustodyBytes, err = stub.GetState(COCKey)
+	COCKey, chainOfCustody, previous, err = loadChainOfCustody(stub, args[0])
 	if err != nil {
-		logger.Error("completeTrasfer ERROR: GetState()\n")
-		return shim.Error(err.Error())
-	}
-
-	err = json.Unmarshal([]byte(chainOfCustodyBytes), &chainOfCustody)
-	if err != nil {
-		logger.Error("completeTrasfer ERROR: json.Unmarshal()\n")
-		return shim.Error(err.Error())
-	}
-	if callerUID != chainOfCustody.DeliveryMan {
-		logger.Error("completeTrasfer ERROR: : The caller must be the current custodian!!\n")
-		return shim.Error("completeTrasfer ERROR : The caller must be the current custodian!!")
-	}
-
-	logger.Info("completeTrasfer: Ok! Caller confirmed!!\n")
-	if chainOfCustody.Status != TRANSFER_PENDING {
-		logger.Error("completeTrasfer ERROR : Asset have not status TRANSFER_PENDING!!\n")
-		return shim.Error("completeTrasfer ERROR : Asset have not status TRANSFER_PENDING!!")
+		logger.Error("completeTrasfer ERROR: loadChainOfCustody()\n")
+		return errorResponseFrom("completeTrasfer", err)
 	}
 	operation = "completeTrasfer"
-	chainOfCustody.Status = IN_CUSTODY
-	event, err = createEvent(stub, callerUID, callerRole, operation)
+	err = prepareCompleteTransfer(stub, chainOfCustody, callerUID, callerRole, "")
 	if err != nil {
-		logger.Error("completeTrasfer ERROR :  createEvent()\n")
-		return shim.Error(err.Error())
+		logger.Error(err.Error())
+		return errorResponseFrom("completeTrasfer", err)
 	}
-	chainOfCustody.Event = event
-	byteCOC, err = json.Marshal(&chainOfCustody)
-	if err != nil {
-		logger.Error("completeTrasfer ERROR :  json.Marshal()\n")
-		return shim.Error(err.Error())
-	}
-
-	err = stub.PutState(COCKey, byteCOC)
+	logger.Info("completeTrasfer: Ok! Caller confirmed!!\n")
+	byteCOC, err = storeChainOfCustody(stub, COCKey, &previous, chainOfCustody, operation, callerUID, callerRole, args)
 	if err != nil {
-		logger.Error("completeTrasfer ERROR : PutState()\n")
-		return shim.Error(err.Error())
+		logger.Error("completeTrasfer ERROR: storeChainOfCustody()\n")
+		return errorResponseFrom("completeTrasfer", err)
 	}
 
 	err = stub.SetEvent("completeTrasfer EVENT: ", byteCOC)
 	if err != nil {
 		logger.Error("completeTrasfer ERROR :  SetEvent()\n")
-		return shim.Error(err.Error())
+		return errorResponse(ERR_LEDGER, "completeTrasfer", err.Error())
 	}
 	logger.Info("completeTrasfer EVENT: ", string(byteCOC))
 
@@ -327,70 +392,45 @@ func (t *DcotWorkflowChaincode) commentChain(stub shim.ChaincodeStubInterface, i
 	var COCKey string
 	var err error
 	var chainOfCustody *ChainOfCustody
-	var chainOfCustodyBytes []byte
 	var byteCOC []byte
 	var callerUID string
 	var callerRole string
 	var operation string
-	var event Event
+	var previous ChainOfCustody
 
 	if len(args) != 2 {
-		return shim.Error("commentChain ERROR: this method must want exactly two argument!!")
+		return errorResponse(ERR_BAD_ARGS, "commentChain", "this method must want exactly two argument!!")
 	}
 
-	COCKey, err = getCOCKey(stub, args[0])
+	COCKey, chainOfCustody, previous, err = loadChainOfCustody(stub, args[0])
 	if err != nil {
-		return shim.Error(err.Error())
+		logger.Error("commentChain ERROR: loadChainOfCustody()\n")
+		return errorResponseFrom("commentChain", err)
 	}
-	chainOfCustodyBytes, err = stub.GetState(COCKey)
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponseFrom("commentChain", err)
 	}
-	err = json.Unmarshal([]byte(chainOfCustodyBytes), &chainOfCustody)
+	operation = "commentChain"
+	chainOfCustody.Status, err = applyTransition(operation, chainOfCustody.Status)
 	if err != nil {
-		return shim.Error(err.Error())
+		logger.Error(err.Error())
+		return errorResponseFrom("commentChain", err)
 	}
-	callerRole, callerUID, err = getTxCreatorInfo(stub)
+
+	chainOfCustody.Text = args[1]
+	byteCOC, err = storeChainOfCustody(stub, COCKey, &previous, chainOfCustody, operation, callerUID, callerRole, args)
 	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if callerRole == CALLER_ROLE_0 {
-		logger.Error("commentChain ERROR: Access denied for a member!!\n")
-		shim.Error("commentChain ERROR: Access denied for a member!!")
+		logger.Error("commentChain ERROR: storeChainOfCustody()\n")
+		return errorResponseFrom("commentChain", err)
 	}
-
-	if callerRole == CALLER_ROLE_1 || callerUID == chainOfCustody.DeliveryMan {
-
-		logger.Info("commentChain: Ok! Caller confirmed!!\n")
-		operation = "commentChain"
-		chainOfCustody.Text = args[1]
-		event, err = createEvent(stub, callerUID, callerRole, operation)
-		if err != nil {
-			logger.Error("commentChain ERROR: createEvent!!\n")
-			return shim.Error(err.Error())
-		}
-		chainOfCustody.Event = event
-		byteCOC, err = json.Marshal(&chainOfCustody)
-		if err != nil {
-			logger.Error("commentChain ERROR: json.Mashal()!!\n")
-			return shim.Error(err.Error())
-		}
-		err = stub.PutState(COCKey, byteCOC)
-		if err != nil {
-			logger.Error("commentChain ERROR: PutState()!!\n")
-			return shim.Error(err.Error())
-		}
-		err = stub.SetEvent("commentChain EVENT: ", byteCOC)
-		if err != nil {
-			logger.Error("commentChain ERROR: SetEvent()!!\n")
-			return shim.Error(err.Error())
-		}
-		logger.Info("commentChain EVENT: ", string(byteCOC))
-		return shim.Success(nil)
+	err = stub.SetEvent("commentChain EVENT: ", byteCOC)
+	if err != nil {
+		logger.Error("commentChain ERROR: SetEvent()!!\n")
+		return errorResponse(ERR_LEDGER, "commentChain", err.Error())
 	}
-	logger.Error("completeTrasfer ERROR : the user's role is not compatible with this operation!")
-	return shim.Error("completeTrasfer ERROR : the user's role is not compatible with this operation!\n")
-
+	logger.Info("commentChain EVENT: ", string(byteCOC))
+	return shim.Success(nil)
 }
 
 //CANCELTRASFER
@@ -402,79 +442,109 @@ func (t *DcotWorkflowChaincode) cancelTrasfer(stub shim.ChaincodeStubInterface,
 	var COCKey string
 	var err error
 	var chainOfCustody *ChainOfCustody
-	var chainOfCustodyBytes []byte
 	var byteCOC []byte
 	var callerUID, callerRole string
 	var operation string
-	var event Event
+	var previous ChainOfCustody
 
 	if len(args) != 1 {
-		return shim.Error("cancelTrasfer ERROR: this method must want exactly one argument!!")
+		return errorResponse(ERR_BAD_ARGS, "cancelTrasfer", "this method must want exactly one argument!!")
+	}
+	COCKey, chainOfCustody, previous, err = loadChainOfCustody(stub, args[0])
+	if err != nil {
+		logger.Error("cancelTrasfer ERROR: loadChainOfCustody()\n")
+		return errorResponseFrom("cancelTrasfer", err)
 	}
-	COCKey, err = getCOCKey(stub, args[0])
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
 	if err != nil {
-		logger.Error("cancelTrasfer ERROR: getCOCKey()\n")
-		return shim.Error(err.Error())
+		return errorResponseFrom("cancelTrasfer", err)
 	}
-	chainOfCustodyBytes, err = stub.GetState(COCKey)
+	operation = "cancelTrasfer"
+	err = checkConsignment(chainOfCustody, operation, "")
 	if err != nil {
-		logger.Error("cancelTrasfer ERROR: getCOCKey()\n")
-		return shim.Error(err.Error())
+		logger.Error(err.Error())
+		return errorResponseFrom("cancelTrasfer", err)
 	}
-	err = json.Unmarshal([]byte(chainOfCustodyBytes), &chainOfCustody)
+	chainOfCustody.Status, err = applyTransition(operation, chainOfCustody.Status)
 	if err != nil {
-		logger.Error("cancelTrasfer ERROR: json.Unmarshal()\n")
-		return shim.Error(err.Error())
+		logger.Error(err.Error())
+		return errorResponseFrom("cancelTrasfer", err)
 	}
-	if chainOfCustody.Status != TRANSFER_PENDING {
-		logger.Error("cancelTrasfer ERROR:  Asset have not status TRANSFER_PENDING!!\n")
-		return shim.Error("cancelTrasfer ERROR : Asset have not status TRANSFER_PENDING!!")
+	chainOfCustody.PendingCustodian = ""
+	chainOfCustody.TransferDeadline = ""
+
+	if len(chainOfCustody.Custodian) == 0 {
+		chainOfCustody.Custodian = callerUID
+		logger.Info("cancelTransfer: Custodian unknown, administrator set as new custodian!", callerUID)
 	}
 
-	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	byteCOC, err = storeChainOfCustody(stub, COCKey, &previous, chainOfCustody, operation, callerUID, callerRole, args)
 	if err != nil {
-		return shim.Error(err.Error())
+		logger.Error("cancelTrasfer ERROR: storeChainOfCustody()\n")
+		return errorResponseFrom("cancelTrasfer", err)
 	}
-	if callerRole == CALLER_ROLE_2 || callerRole == CALLER_ROLE_3 {
-		logger.Error("cancelTransfer ERROR: caller is a operator/delivery_operator!")
-		return shim.Error("cancelTransfer ERROR: caller is a operator/delivery_operator!")
+	err = stub.SetEvent("cancelTrasfer EVENT: ", byteCOC)
+	if err != nil {
+		logger.Error("cancelTrasfer ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, "cancelTrasfer", err.Error())
 	}
-	if callerUID == chainOfCustody.DeliveryMan || callerRole == CALLER_ROLE_1 {
-		logger.Info("cancelTrasfer: Ok! Caller confirmed!!\n")
-		operation = "cancelTrasfer"
-		chainOfCustody.Status = IN_CUSTODY
+	logger.Info("cancelTrasfer EVENT: ", string(byteCOC))
+	return shim.Success(nil)
+}
 
-		if callerRole == CALLER_ROLE_1 {
-			chainOfCustody.DeliveryMan = callerUID
-			logger.Info("cancelTransfer: Administration operation, new delivery man set!", callerUID)
-		}
+//REJECTTRANSFER: ChainOfCustody must exist and have 'TRANSFER_PENDING' status,
+//The caller must be the designed receiver(PendingCustodian), custody stays with the current custodian
 
-		event, err = createEvent(stub, callerUID, callerRole, operation)
-		if err != nil {
-			logger.Error("cancelTrasfer ERROR: createEvent()\n")
-			return shim.Error(err.Error())
-		}
-		chainOfCustody.Event = event
-		byteCOC, err = json.Marshal(&chainOfCustody)
-		if err != nil {
-			logger.Error("cancelTrasfer ERROR: json.Marshal()\n")
-			return shim.Error(err.Error())
-		}
-		err = stub.PutState(COCKey, byteCOC)
-		if err != nil {
-			logger.Error("cancelTrasfer ERROR: PutState()\n")
-			return shim.Error(err.Error())
-		}
-		err = stub.SetEvent("cancelTrasfer EVENT: ", byteCOC)
-		if err != nil {
-			logger.Error("cancelTrasfer ERROR: SetEvent()\n")
-			return shim.Error(err.Error())
-		}
-		logger.Info("cancelTrasfer EVENT: ", string(byteCOC))
-		return shim.Success(nil)
+func (t *DcotWorkflowChaincode) rejectTransfer(stub shim.ChaincodeStubInterface, isEnabled bool, args []string) pb.Response {
+
+	logger.Debug("rejectTransfer()")
+
+	var COCKey string
+	var err error
+	var chainOfCustody *ChainOfCustody
+	var byteCOC []byte
+	var callerRole, callerUID string
+	var operation string
+	var previous ChainOfCustody
+
+	if len(args) != 1 {
+		return errorResponse(ERR_BAD_ARGS, "rejectTransfer", "this method must want exactly one argument!!")
+	}
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	if err != nil {
+		return errorResponseFrom("rejectTransfer", err)
+	}
+	COCKey, chainOfCustody, previous, err = loadChainOfCustody(stub, args[0])
+	if err != nil {
+		logger.Error("rejectTransfer ERROR: loadChainOfCustody()\n")
+		return errorResponseFrom("rejectTransfer", err)
+	}
+	operation = "rejectTransfer"
+	err = checkConsignment(chainOfCustody, operation, "")
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("rejectTransfer", err)
+	}
+	chainOfCustody.Status, err = applyTransition(operation, chainOfCustody.Status)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("rejectTransfer", err)
+	}
+	logger.Info("rejectTransfer: Ok! Caller confirmed!!\n")
+	chainOfCustody.PendingCustodian = ""
+	chainOfCustody.TransferDeadline = ""
+	byteCOC, err = storeChainOfCustody(stub, COCKey, &previous, chainOfCustody, operation, callerUID, callerRole, args)
+	if err != nil {
+		logger.Error("rejectTransfer ERROR: storeChainOfCustody()\n")
+		return errorResponseFrom("rejectTransfer", err)
 	}
-	logger.Error("cancelTrasfer ERROR : The caller must be the current custodian or have administrator role!!\n")
-	return shim.Error("cancelTrasfer ERROR : The caller must be the current custodian or have administrator role!!")
+	err = stub.SetEvent("rejectTransfer EVENT: ", byteCOC)
+	if err != nil {
+		logger.Error("rejectTransfer ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, "rejectTransfer", err.Error())
+	}
+	logger.Info("rejectTransfer EVENT: ", string(byteCOC))
+	return shim.Success(nil)
 }
 
 //TERMINATECHAIN
@@ -487,77 +557,49 @@ func (t *DcotWorkflowChaincode) terminateChain(stub shim.ChaincodeStubInterface,
 	var COCKey string
 	var err error
 	var chainOfCustody *ChainOfCustody
-	var chainOfCustodyBytes []byte
 	var byteCOC []byte
 	var callerUID, callerRole string
 	var operation string
-	var event Event
+	var previous ChainOfCustody
 
 	if len(args) != 1 {
-		return shim.Error("terminateChain ERROR: this method must want exactly one argument!!")
+		return errorResponse(ERR_BAD_ARGS, "terminateChain", "this method must want exactly one argument!!")
 	}
-	COCKey, err = getCOCKey(stub, args[0])
+	COCKey, chainOfCustody, previous, err = loadChainOfCustody(stub, args[0])
 	if err != nil {
-		logger.Error("terminateChain ERROR: getCOCKey()\n")
-		return shim.Error(err.Error())
+		logger.Error("terminateChain ERROR: loadChainOfCustody()\n")
+		return errorResponseFrom("terminateChain", err)
 	}
-	chainOfCustodyBytes, err = stub.GetState(COCKey)
+	operation = "terminateChain"
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
 	if err != nil {
-		logger.Error("terminateChain ERROR: GetState()\n")
-		return shim.Error(err.Error())
+		logger.Error("terminateChain ERROR: getTxCreatorInfo\n")
+		return errorResponseFrom("terminateChain", err)
 	}
-	err = json.Unmarshal([]byte(chainOfCustodyBytes), &chainOfCustody)
+	err = checkConsignment(chainOfCustody, operation, "")
 	if err != nil {
-		logger.Error("terminateChain ERROR: json.Unmarshal()\n")
-		return shim.Error(err.Error())
+		logger.Error(err.Error())
+		return errorResponseFrom("terminateChain", err)
 	}
-	if chainOfCustody.Status != IN_CUSTODY {
-		logger.Error("terminateChain ERROR:  Asset have not status IN_CUSTODY!!\n")
-		return shim.Error("terminateChain ERROR : Asset have not status IN_CUSTODY!!")
+	chainOfCustody.Status, err = applyTransition(operation, chainOfCustody.Status)
+	if err != nil {
+		logger.Error(err.Error())
+		return errorResponseFrom("terminateChain", err)
 	}
-	operation = "terminateChain"
-	callerRole, callerUID, err = getTxCreatorInfo(stub)
+
+	byteCOC, err = storeChainOfCustody(stub, COCKey, &previous, chainOfCustody, operation, callerUID, callerRole, args)
 	if err != nil {
-		logger.Error("terminateChain ERROR: getTxCreatorInfo\n")
-		return shim.Error(err.Error())
+		logger.Error("terminateChain ERROR: storeChainOfCustody()\n")
+		return errorResponseFrom("terminateChain", err)
 	}
-	if callerRole == CALLER_ROLE_0 || callerRole == CALLER_ROLE_2 {
-		logger.Error("terminateChain ERROR : Access denied for member or operator!!\n")
-		return shim.Error("terminateChain ERROR : Access denied for member or operator!!")
+	err = stub.SetEvent("terminateChain EVENT: ", byteCOC)
+	if err != nil {
+		logger.Error("terminateChain ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, "terminateChain", err.Error())
 	}
+	logger.Info("terminateChain EVENT: ", string(byteCOC))
 
-	if callerRole == CALLER_ROLE_1 || callerUID == chainOfCustody.DeliveryMan {
-
-		logger.Info("terminateChain: Ok! Caller confirmed!!\n")
-
-		chainOfCustody.Status = RELEASED
-		event, err = createEvent(stub, callerUID, callerRole, operation)
-		if err != nil {
-			logger.Error("terminateChain ERROR: createEvent()\n")
-			return shim.Error(err.Error())
-		}
-		chainOfCustody.Event = event
-		byteCOC, err = json.Marshal(&chainOfCustody)
-		if err != nil {
-			logger.Error("terminateChain ERROR: json.Marshal()\n")
-			return shim.Error(err.Error())
-		}
-		err = stub.PutState(COCKey, byteCOC)
-		if err != nil {
-			logger.Error("terminateChain ERROR: createEPutStatevent()\n")
-			return shim.Error(err.Error())
-		}
-		err = stub.SetEvent("terminateChain EVENT: ", byteCOC)
-		if err != nil {
-			logger.Error("terminateChain ERROR: SetEvent()\n")
-			return shim.Error(err.Error())
-		}
-		logger.Info("terminateChain EVENT: ", string(byteCOC))
-
-		return shim.Success(nil)
-	}
-	logger.Error("terminateChain ERROR : The caller must be the current custodian ora have a administrator role!!\n")
-	return shim.Error("terminateChain ERROR : The caller must be the current custodian ora have a administrator role!!")
+	return shim.Success(nil)
 }
 
 //UPDATEDOCUMENT
@@ -569,74 +611,54 @@ func (t *DcotWorkflowChaincode) updateDocument(stub shim.ChaincodeStubInterface,
 	var COCKey string
 	var err error
 	var chainOfCustody *ChainOfCustody
-	var chainOfCustodyBytes []byte
 	var byteCOC []byte
 	var jsonResp string
 	var callerUID, callerRole string
 	var operation string
-	var event Event
+	var previous ChainOfCustody
 
 	if len(args) != 2 {
-		return shim.Error("updateDocument ERROR: this method must want exactly two argument!!")
+		return errorResponse(ERR_BAD_ARGS, "updateDocument", "this method must want exactly two argument!!")
 	}
 
-	COCKey, err = getCOCKey(stub, args[0])
+	COCKey, chainOfCustody, previous, err = loadChainOfCustody(stub, args[0])
 	if err != nil {
-		logger.Info("updateDocument ERROR: getCOCKey() \n")
-		return shim.Error(err.Error())
+		logger.Error("updateDocument ERROR: loadChainOfCustody()\n")
+		return errorResponseFrom("updateDocument", err)
 	}
-	chainOfCustodyBytes, err = stub.GetState(COCKey)
+	callerRole, callerUID, err = getTxCreatorInfo(stub)
 	if err != nil {
-		logger.Info("updateDocument ERROR: GetState() \n")
-		return shim.Error(err.Error())
+		logger.Info("updateDocument ERROR: getTxCreatorInfo()\n")
+		return errorResponseFrom("updateDocument", err)
 	}
-	err = json.Unmarshal([]byte(chainOfCustodyBytes), &chainOfCustody)
+	operation = "updateDocument"
+	chainOfCustody.Status, err = applyTransition(operation, chainOfCustody.Status)
 	if err != nil {
-		logger.Info("updateDocument ERROR: json.Unmarshal()\n")
-		return shim.Error(err.Error())
+		logger.Error(err.Error())
+		return errorResponseFrom("updateDocument", err)
 	}
-	callerRole, callerUID, err = getTxCreatorInfo(stub)
+	logger.Info("updateDocument: Ok! Caller confirmed!!\n")
+
+	chainOfCustody.DocumentId = args[1]
+	message := checkChainOfCustodyField(chainOfCustody, "documentId", true)
+	if len(message) != 0 {
+		logger.Error("updateDocument ERROR: the DocumentId is not valid!!\n")
+		return errorResponseWithDetails(ERR_BAD_ARGS, "updateDocument", "the DocumentId is not valid!!", []FieldError{{"documentId", message}})
+	}
+	byteCOC, err = storeChainOfCustody(stub, COCKey, &previous, chainOfCustody, operation, callerUID, callerRole, args)
 	if err != nil {
-		logger.Info("updateDocument ERROR: getTxCreatorInfo()\n")
-		return shim.Error(err.Error())
+		logger.Error("updateDocument ERROR: storeChainOfCustody()\n")
+		return errorResponseFrom("updateDocument", err)
 	}
-	if callerRole == CALLER_ROLE_1 {
-		logger.Info("updateDocument: Ok! Caller confirmed!!\n")
-
-		if chainOfCustody.Status != IN_CUSTODY {
-			logger.Info("updateDocument ERROR: Asset's status is not IN_CUSTODY!!!\n")
-			return shim.Error("updateDocument ERROR: Asset's status is not IN_CUSTODY!!!")
-		}
-		operation = "updateDocument"
-		chainOfCustody.DocumentId = args[1]
-		event, err = createEvent(stub, callerUID, callerRole, operation)
-		if err != nil {
-			logger.Info("updateDocument ERROR: createEvent()\n")
-			return shim.Error(err.Error())
-		}
-		chainOfCustody.Event = event
-		byteCOC, err = json.Marshal(&chainOfCustody)
-		if err != nil {
-			logger.Info("updateDocument ERROR: json.Marshal()\n")
-			return shim.Error(err.Error())
-		}
-		err = stub.PutState(COCKey, byteCOC)
-		if err != nil {
-			logger.Info("updateDocument ERROR: PutState()\n")
-			return shim.Error(err.Error())
-		}
-		err = stub.SetEvent("updateDocument EVENT:", byteCOC)
-		if err != nil {
-			logger.Info("updateDocument ERROR: SetEvent()\n")
-			return shim.Error(err.Error())
-		}
-		logger.Info("updateDocument EVENT: ", string(byteCOC))
-		jsonResp = string(byteCOC)
-		logger.Info("Query Response:\n", jsonResp)
-		return shim.Success([]byte(jsonResp))
+	err = stub.SetEvent("updateDocument EVENT:", byteCOC)
+	if err != nil {
+		logger.Info("updateDocument ERROR: SetEvent()\n")
+		return errorResponse(ERR_LEDGER, "updateDocument", err.Error())
 	}
-	logger.Error("cancelTrasfer ERROR : the user's role is not compatible with this operation!!\n")
-	return shim.Error("cancelTrasfer ERROR : the user's role is not compatible with this operation!!\n")
+	logger.Info("updateDocument EVENT: ", string(byteCOC))
+	jsonResp = string(byteCOC)
+	logger.Info("Query Response:\n", jsonResp)
+	return shim.Success([]byte(jsonResp))
 }
 
 //GETASSETDETAILS
@@ -646,50 +668,33 @@ func (t *DcotWorkflowChaincode) getAssetDetails(stub shim.ChaincodeStubInterface
 
 	logger.Debug("getAssetDetails()")
 
-	var COCKey string
 	var err error
 	var chainOfCustody *ChainOfCustody
-	var chainOfCustodyBytes []byte
 	var byteCOC []byte
 	var jsonResp string
-	var callerRole string
 
 	if len(args) != 1 {
-		return shim.Error("getAssetDetails ERROR: this method must want exactly one argument!!")
+		return errorResponse(ERR_BAD_ARGS, "getAssetDetails", "this method must want exactly one argument!!")
 	}
-	COCKey, err = getCOCKey(stub, args[0])
+	_, chainOfCustody, _, err = loadChainOfCustody(stub, args[0])
 	if err != nil {
-		logger.Error("getAssetDetails ERROR : getCOCKey()\n")
-		return shim.Error(err.Error())
+		logger.Error("getAssetDetails ERROR: loadChainOfCustody()\n")
+		return errorResponseFrom("getAssetDetails", err)
 	}
-	chainOfCustodyBytes, err = stub.GetState(COCKey)
+	_, err = applyTransition("getAssetDetails", chainOfCustody.Status)
 	if err != nil {
-		logger.Error("getAssetDetails ERROR : GetState())\n")
-		return shim.Error(err.Error())
+		logger.Error(err.Error())
+		return errorResponseFrom("getAssetDetails", err)
 	}
-	err = json.Unmarshal([]byte(chainOfCustodyBytes), &chainOfCustody)
+	logger.Info("getAssetDetails: Ok! Caller confirmed!!\n")
+	byteCOC, err = json.Marshal(chainOfCustody)
 	if err != nil {
-		logger.Error("getAssetDetails ERROR : json.Unmarshal()\n")
-		return shim.Error(err.Error())
-	}
-	callerRole, _, err = getTxCreatorInfo(stub)
-	if err != nil {
-		logger.Error("getAssetDetails ERROR : getTxCreatorInfo\n")
-		return shim.Error(err.Error())
-	}
-	if callerRole == CALLER_ROLE_1 || callerRole == CALLER_ROLE_2 || callerRole == CALLER_ROLE_3 {
-		logger.Info("getAssetDetails: Ok! Caller confirmed!!\n")
-		byteCOC, err = json.Marshal(&chainOfCustody)
-		if err != nil {
-			logger.Error("getAssetDetails ERROR : json.Marshal()\n")
-			return shim.Error(err.Error())
-		}
-		jsonResp = string(byteCOC)
-		logger.Info("Query Response:\n", jsonResp)
-		return shim.Success([]byte(jsonResp))
+		logger.Error("getAssetDetails ERROR : json.Marshal()\n")
+		return errorResponseFrom("getAssetDetails", err)
 	}
-	logger.Error("getAssetDetails ERROR : the user's role is not compatible with this operation!")
-	return shim.Error("getAssetDetails ERROR : the user's role is not compatible with this operation!\n")
+	jsonResp = string(byteCOC)
+	logger.Info("Query Response:\n", jsonResp)
+	return shim.Success([]byte(jsonResp))
 }
 
 //GETCHAINOFEVENTS
@@ -708,57 +713,54 @@ func (t *DcotWorkflowChaincode) getChainOfEvents(stub shim.ChaincodeStubInterfac
 	var err error
 
 	if len(args) != 1 {
-		return shim.Error("getChainOfEvents ERROR: this method must want exactly one argument!!")
+		return errorResponse(ERR_BAD_ARGS, "getChainOfEvents", "this method must want exactly one argument!!")
 	}
 	callerRole, _, err = getTxCreatorInfo(stub)
 	if err != nil {
 		logger.Error("getChainOfEvents ERROR: getTxCreatorInfo()\n ")
-		return shim.Error(err.Error())
+		return errorResponseFrom("getChainOfEvents", err)
 	}
 	logger.Info("caller_ROLE :" + string(callerRole) + " . \n")
-	if callerRole == CALLER_ROLE_1 {
-		logger.Info("getChainOfEvents: Ok! Caller confirmed!!\n")
-		COCKey, err2 = getCOCKey(stub, args[0])
-		if err2 != nil {
-			logger.Error("getChainOfEvents ERROR: getCOCKey()\n ")
-			return shim.Error(err2.Error())
+	COCKey, err2 = getCOCKey(stub, args[0])
+	if err2 != nil {
+		logger.Error("getChainOfEvents ERROR: getCOCKey()\n ")
+		return errorResponseFrom("getChainOfEvents", err2)
+	}
+	historyResponse, err3 := stub.GetHistoryForKey(COCKey)
+	if err3 != nil {
+		logger.Error("getChainOfEvents ERROR: GetHistoryForKey()\n ")
+		return errorResponse(ERR_LEDGER, "getChainOfEvents", err3.Error())
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+	for historyResponse.HasNext() {
+		COCarray, err1 := historyResponse.Next()
+		if err1 != nil {
+			logger.Error("getChainOfEvents ERROR: historyResponse.Next()\n ")
+			return errorResponse(ERR_LEDGER, "getChainOfEvents", err1.Error())
 		}
-		historyResponse, err3 := stub.GetHistoryForKey(COCKey)
-		if err3 != nil {
-			logger.Error("getChainOfEvents ERROR: GetHistoryForKey()\n ")
-			return shim.Error(err3.Error())
+		err = json.Unmarshal([]byte(COCarray.Value), &chainOfCustody)
+		if err != nil {
+			logger.Error("getChainOfEvents ERROR: json.Unmarshal()\n ")
+			return errorResponse(ERR_CORRUPT_RECORD, "getChainOfEvents", err.Error())
 		}
-		var buffer bytes.Buffer
-		buffer.WriteString("[")
-		for historyResponse.HasNext() {
-			COCarray, err1 := historyResponse.Next()
-			if err1 != nil {
-				logger.Error("getChainOfEvents ERROR: historyResponse.Next()\n ")
-				return shim.Error(err1.Error())
-			}
-			err = json.Unmarshal([]byte(COCarray.Value), &chainOfCustody)
-			if err != nil {
-				logger.Error("getChainOfEvents ERROR: json.Unmarshal()\n ")
-				return shim.Error(err.Error())
-			}
-			byteCOC, err2 = json.Marshal(&chainOfCustody)
-			if err2 != nil {
-				logger.Error("getChainOfEvents ERROR: json.Marshal()\n ")
-				return shim.Error(err2.Error())
-			}
-			logger.Debug("byteCOC :", string(byteCOC))
-			buffer.WriteString(string(byteCOC))
-			buffer.WriteString(",")
+		// the OTP hash of the legacy records is never returned
+		chainOfCustody.OtpSalt = ""
+		chainOfCustody.OtpHash = ""
+		byteCOC, err2 = json.Marshal(&chainOfCustody)
+		if err2 != nil {
+			logger.Error("getChainOfEvents ERROR: json.Marshal()\n ")
+			return errorResponseFrom("getChainOfEvents", err2)
 		}
-		jsonResp = buffer.String()
-		subString := jsonResp[0 : len(jsonResp)-1]
-		jsonResponse = subString + "]"
-		logger.Debug("Query Response:\n" + jsonResponse)
-		return shim.Success([]byte(jsonResponse))
-	}
-	logger.Error("getChainOfEvents ERROR : the user's role is not compatible with this operation!\n")
-	return shim.Error("getChainOfEvents ERROR : the user's role is not compatible with this operation!\n")
-
+		logger.Debug("byteCOC :", string(byteCOC))
+		buffer.WriteString(string(byteCOC))
+		buffer.WriteString(",")
+	}
+	jsonResp = buffer.String()
+	subString := jsonResp[0 : len(jsonResp)-1]
+	jsonResponse = subString + "]"
+	logger.Debug("Query Response:\n" + jsonResponse)
+	return shim.Success([]byte(jsonResponse))
 }
 
 func main() {
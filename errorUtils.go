@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//ERROR CODES: every failed operation returns the json of an ErrorResponse,
+//clients must check the code, the message is for humans and may change.
+
+const (
+	ERR_BAD_ARGS         = "BAD_ARGS"         // wrong number of arguments, malformed json or invalid values
+	ERR_FORBIDDEN        = "FORBIDDEN"        // the caller's role or identity can't perform the operation
+	ERR_NOT_FOUND        = "NOT_FOUND"        // the ChainOfCustody or another record doesn't exist
+	ERR_ALREADY_EXISTS   = "ALREADY_EXISTS"   // the record to create already exists
+	ERR_INVALID_STATE    = "INVALID_STATE"    // the status of the record doesn't allow the operation
+	ERR_UNKNOWN_FUNCTION = "UNKNOWN_FUNCTION" // Invoke was called with an unknown function name
+	ERR_CORRUPT_RECORD   = "CORRUPT_RECORD"   // the record exists but can't be decoded
+	ERR_LEDGER           = "LEDGER_ERROR"     // reading or writing the world state failed
+	ERR_INTERNAL         = "INTERNAL"         // serialization or identity failure
+)
+
+type ErrorResponse struct {
+	Code      string      `json:"code"`
+	Operation string      `json:"operation"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+func (e *ErrorResponse) Error() string {
+	errorBytes, err := json.Marshal(e)
+	if err != nil {
+		return e.Message
+	}
+	return string(errorBytes)
+}
+
+//NEWERROR: the helpers that don't know the operation leave it empty,
+//errorResponseFrom fills it in
+
+func newError(code string, operation string, message string) *ErrorResponse {
+	return &ErrorResponse{Code: code, Operation: operation, Message: message}
+}
+
+//WRAPERROR: reports err as an error of operation, keeping its code when it is an ErrorResponse
+
+func wrapError(operation string, err error, details interface{}) *ErrorResponse {
+	wrapped, ok := err.(*ErrorResponse)
+	if !ok {
+		return &ErrorResponse{Code: ERR_INTERNAL, Operation: operation, Message: err.Error(), Details: details}
+	}
+	return &ErrorResponse{Code: wrapped.Code, Operation: operation, Message: wrapped.Message, Details: details}
+}
+
+func errorResponse(code string, operation string, message string) pb.Response {
+	return shim.Error(newError(code, operation, message).Error())
+}
+
+func errorResponseWithDetails(code string, operation string, message string, details interface{}) pb.Response {
+	return shim.Error((&ErrorResponse{Code: code, Operation: operation, Message: message, Details: details}).Error())
+}
+
+//ERRORRESPONSEFROM: errors that are not an ErrorResponse are returned as INTERNAL
+
+func errorResponseFrom(operation string, err error) pb.Response {
+	chaincodeError, ok := err.(*ErrorResponse)
+	if !ok {
+		chaincodeError = newError(ERR_INTERNAL, operation, err.Error())
+	} else if len(chaincodeError.Operation) == 0 {
+		chaincodeError.Operation = operation
+	}
+	return shim.Error(chaincodeError.Error())
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestErrorResponsesKeepTheirCode(t *testing.T) {
+	if response := errorResponseFrom("startTransfer", errors.New("boom")); response.Message != `{"code":"INTERNAL","operation":"startTransfer","message":"boom"}` {
+		t.Fatalf("plain error: %s", response.Message)
+	}
+	if response := errorResponseFrom("startTransfer", newError(ERR_NOT_FOUND, "", "missing")); response.Message != `{"code":"NOT_FOUND","operation":"startTransfer","message":"missing"}` {
+		t.Fatalf("error without operation: %s", response.Message)
+	}
+	wrapped := wrapError("startTransferBatch", newError(ERR_INVALID_STATE, "startTransfer", "released"), "id1")
+	if wrapped.Code != ERR_INVALID_STATE || wrapped.Operation != "startTransferBatch" || wrapped.Details != "id1" {
+		t.Fatalf("wrapped error: %+v", wrapped)
+	}
+	if wrapped = wrapError("startTransferBatch", errors.New("boom"), "id1"); wrapped.Code != ERR_INTERNAL {
+		t.Fatalf("wrapped plain error: %+v", wrapped)
+	}
+}
+
+func TestEveryOperationReportsItsOwnName(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+
+	custodyId := stub.newChain(t, member, "T1")
+	expectEnvelope := func(code string, caller testCaller, function string, args ...string) ErrorResponse {
+		t.Helper()
+
+		var errorResponse ErrorResponse
+
+		response := stub.invoke(t, caller, function, args...)
+		err := json.Unmarshal([]byte(response.Message), &errorResponse)
+		if err != nil || errorResponse.Code != code || errorResponse.Operation != function || len(errorResponse.Message) == 0 {
+			t.Fatalf("%s %v: expected %s, got %q", function, args, code, response.Message)
+		}
+		return errorResponse
+	}
+
+	for function, args := range map[string][]string{"commentChain": {"missing", "text"}, "updateDocument": {"missing", "D1"}, "cancelTrasfer": {"missing"}, "terminateChain": {"missing"}} {
+		expectEnvelope(ERR_NOT_FOUND, admin, function, args...)
+	}
+	expectEnvelope(ERR_BAD_ARGS, admin, "commentChain", custodyId)
+	expectEnvelope(ERR_UNKNOWN_FUNCTION, admin, "fly", custodyId)
+	expectEnvelope(ERR_FORBIDDEN, member, "terminateChain", custodyId)
+	stub.mustInvoke(t, admin, "terminateChain", custodyId)
+	expectEnvelope(ERR_INVALID_STATE, admin, "cancelTrasfer", custodyId)
+	batchError := expectEnvelope(ERR_INVALID_STATE, member, "startTransferBatch", `["`+custodyId+`"]`, "op1")
+	if batchError.Details != custodyId {
+		t.Fatalf("details of the failed batch: %v", batchError.Details)
+	}
+}
+
+func TestLedgerAndDecodingFailuresHaveTheirCodes(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+
+	custodyId := stub.newChain(t, member, "T1")
+
+	stub.putStateError = errors.New("disk full")
+	stub.expectError(t, ERR_LEDGER, admin, "commentChain", custodyId, "no space")
+	stub.expectError(t, ERR_LEDGER, admin, "registerParticipant", `{"uid":"op1","role":"operator","office":"RM01","active":true}`)
+	stub.expectError(t, ERR_LEDGER, member, "initNewChain", `{"trackingId":"T2","documentId":"D2","weightOfParcel":2,"sortingCenterDestination":"SC1","distributionOfficeCode":"RM01"}`)
+	stub.putStateError = nil
+
+	stub.register(t, admin, operator)
+	investigationKey, _ := getInvestigationKey(stub, custodyId, "broken")
+	stub.MockTransactionStart("corrupt")
+	stub.PutState(investigationKey, []byte(`{"id":`))
+	stub.MockTransactionEnd("corrupt")
+	stub.expectError(t, ERR_CORRUPT_RECORD, admin, "getInvestigations", custodyId)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Immutable event log of a ChainOfCustody, one entry for every operation
+const CUSTODY_EVENT_KEY = "custodyId~seq"
+
+//APPENDCUSTODYEVENT: must be called after current.Event is set and before current is stored,
+//because it increments current.EventCount and sets current.Event.OnBehalfOf when the caller
+//acts under a Delegation. previous is nil for a new ChainOfCustody.
+
+func appendCustodyEvent(stub shim.ChaincodeStubInterface, previous *ChainOfCustody, current *ChainOfCustody, args []string) error {
+	var custodyEvent CustodyEvent
+	var err error
+
+	if previous != nil {
+		current.Event.OnBehalfOf, err = delegatorOf(stub, current.Event.Caller, previous)
+	} else {
+		current.Event.OnBehalfOf, err = delegatorOf(stub, current.Event.Caller, current)
+	}
+	if err != nil {
+		return err
+	}
+	custodyEvent.DocType = DOC_TYPE_CUSTODY_EVENT
+	custodyEvent.CustodyId = current.Id
+	custodyEvent.Seq = current.EventCount
+	custodyEvent.NewCustodian = current.Custodian
+	custodyEvent.NewStatus = current.Status
+	custodyEvent.Args = args
+	custodyEvent.Event = current.Event
+	if previous != nil {
+		custodyEvent.PreviousCustodian = previous.Custodian
+		custodyEvent.PreviousStatus = previous.Status
+	}
+
+	eventKey, err := stub.CreateCompositeKey(CUSTODY_EVENT_KEY, []string{current.Id, fmt.Sprintf("%010d", custodyEvent.Seq)})
+	if err != nil {
+		return err
+	}
+	eventBytes, err := json.Marshal(&custodyEvent)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(eventKey, eventBytes)
+	if err != nil {
+		return newError(ERR_LEDGER, "", err.Error())
+	}
+	current.EventCount++
+	return nil
+}
+
+//GETCUSTODYEVENTS: returns the event log of a ChainOfCustody ordered by sequence number
+
+func getCustodyEvents(stub shim.ChaincodeStubInterface, custodyId string) ([]CustodyEvent, error) {
+	custodyEvents := []CustodyEvent{}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(CUSTODY_EVENT_KEY, []string{custodyId})
+	if err != nil {
+		return nil, newError(ERR_LEDGER, "", err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		var custodyEvent CustodyEvent
+
+		eventEntry, err := resultsIterator.Next()
+		if err != nil {
+			return nil, newError(ERR_LEDGER, "", err.Error())
+		}
+		err = json.Unmarshal(eventEntry.Value, &custodyEvent)
+		if err != nil {
+			return nil, newError(ERR_CORRUPT_RECORD, "", eventEntry.Key+" can't be decoded: "+err.Error())
+		}
+		custodyEvents = append(custodyEvents, custodyEvent)
+	}
+	return custodyEvents, nil
+}
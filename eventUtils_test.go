@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+func TestCustodyTrailRecordsEveryOperation(t *testing.T) {
+	var trail []CustodyEvent
+
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+
+	stub.register(t, admin, operator)
+	custodyId := stub.newChain(t, member, "T1")
+	stub.mustInvoke(t, member, "startTransfer", custodyId, "op1")
+	stub.mustInvoke(t, operator, "completeTrasfer", custodyId)
+	for comment := 0; comment < 10; comment++ {
+		stub.mustInvoke(t, operator, "commentChain", custodyId, "check "+strconv.Itoa(comment))
+	}
+
+	payload := stub.mustInvoke(t, operator, "getCustodyTrail", custodyId)
+	json.Unmarshal(payload, &trail)
+	if len(trail) != 13 || stub.getChain(t, custodyId).EventCount != 13 {
+		t.Fatalf("the trail has %d events", len(trail))
+	}
+	for seq, custodyEvent := range trail {
+		if custodyEvent.Seq != seq || custodyEvent.CustodyId != custodyId || custodyEvent.DocType != DOC_TYPE_CUSTODY_EVENT {
+			t.Fatalf("event %d of the trail: %+v", seq, custodyEvent)
+		}
+	}
+	expected := []CustodyEvent{
+		{PreviousCustodian: "", NewCustodian: member.identity(), PreviousStatus: "", NewStatus: IN_CUSTODY},
+		{PreviousCustodian: member.identity(), NewCustodian: member.identity(), PreviousStatus: IN_CUSTODY, NewStatus: TRANSFER_PENDING},
+		{PreviousCustodian: member.identity(), NewCustodian: operator.identity(), PreviousStatus: TRANSFER_PENDING, NewStatus: IN_CUSTODY},
+	}
+	operations := []string{"initNewChain", "startTransfer", "completeTrasfer"}
+	for index, custodyEvent := range trail[:3] {
+		if custodyEvent.PreviousCustodian != expected[index].PreviousCustodian || custodyEvent.NewCustodian != expected[index].NewCustodian ||
+			custodyEvent.PreviousStatus != expected[index].PreviousStatus || custodyEvent.NewStatus != expected[index].NewStatus || custodyEvent.Operation != operations[index] {
+			t.Fatalf("event %d of the trail: %+v", index, custodyEvent)
+		}
+	}
+	if args := trail[1].Args; len(args) != 2 || args[0] != custodyId || args[1] != "op1" {
+		t.Fatalf("arguments of startTransfer in the trail: %v", args)
+	}
+	if last := trail[12]; last.Operation != "commentChain" || last.Args[1] != "check 9" {
+		t.Fatalf("last event of the trail: %+v", last)
+	}
+}
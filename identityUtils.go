@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//IDENTITY: a caller is identified by the MSPID of the organization that issued his certificate
+//and by its uid attribute, two organizations may issue the same uid to different people.
+//Custodians, receivers, participants and role assignments store the pair as "MSPID/UID".
+
+const IDENTITY_SEPARATOR = "/"
+
+func qualifiedIdentity(mspid string, uid string) string {
+	if len(uid) == 0 {
+		return ""
+	}
+	return mspid + IDENTITY_SEPARATOR + uid
+}
+
+//SPLITIDENTITY: returns the MSPID and the UID of an identity, the MSPID is empty for a bare UID.
+//A MSPID never contains the separator, so the UID may.
+
+func splitIdentity(identity string) (string, string) {
+	parts := strings.SplitN(identity, IDENTITY_SEPARATOR, 2)
+	if len(parts) == 1 {
+		return "", parts[0]
+	}
+	return parts[0], parts[1]
+}
+
+func identityOrg(identity string) string {
+	mspid, _ := splitIdentity(identity)
+	return mspid
+}
+
+//RESOLVEIDENTITY: the identities passed as arguments may be bare UIDs, they belong to the
+//organization of the caller. An identity of another organization must be written with its MSPID,
+//so a handover across organizations is always explicit.
+
+func resolveIdentity(callerIdentity string, identity string) string {
+	if len(identity) == 0 || strings.Contains(identity, IDENTITY_SEPARATOR) {
+		return identity
+	}
+	return qualifiedIdentity(identityOrg(callerIdentity), identity)
+}
+
+//RESOLVEIDENTITYARG: returns a copy of args whose first element, an identity, is resolved for the caller
+
+func resolveIdentityArg(stub shim.ChaincodeStubInterface, args []string) ([]string, error) {
+
+	if len(args) == 0 {
+		return args, nil
+	}
+	_, callerUID, err := getTxCreatorInfo(stub)
+	if err != nil {
+		return nil, err
+	}
+	resolved := append([]string{resolveIdentity(callerUID, args[0])}, args[1:]...)
+	return resolved, nil
+}
+
+//CHECKADMINORG: when the configuration restricts the administrators to their organization,
+//they can't manage the participants and the role assignments of the other organizations
+
+func checkAdminOrg(stub shim.ChaincodeStubInterface, operation string, callerIdentity string, identity string) error {
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	if config.RestrictAdminsToOwnerOrg && identityOrg(identity) != identityOrg(callerIdentity) {
+		return newError(ERR_FORBIDDEN, operation, "the identity "+identity+" belongs to another organization!!")
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//JURISDICTION: the office and optionally the zone a caller works in, they are matched
+//against DistributionOfficeCode and DistributionZone of the parcels.
+//An empty Zone covers the whole office.
+
+type Jurisdiction struct {
+	Office string `json:"office"`
+	Zone   string `json:"zone,omitempty"`
+}
+
+//GETCALLERJURISDICTION: the office and zone attributes of the caller's certificate,
+//or those of his entry in the participant registry when the certificate has no office.
+//Returns nil if the caller has no office.
+
+func getCallerJurisdiction(stub shim.ChaincodeStubInterface, callerUID string) (*Jurisdiction, error) {
+
+	office, found, err := cid.GetAttributeValue(stub, OFFICE)
+	if err != nil {
+		return nil, err
+	}
+	if found && len(office) != 0 {
+		zone, _, err := cid.GetAttributeValue(stub, ZONE)
+		if err != nil {
+			return nil, err
+		}
+		return &Jurisdiction{office, zone}, nil
+	}
+	participant, err := getParticipant(stub, callerUID)
+	if err != nil {
+		return nil, err
+	}
+	return participantJurisdiction(participant), nil
+}
+
+//PARTICIPANTJURISDICTION: the office and zone of an entry of the participant registry,
+//nil if the participant is missing, not active or has no office
+
+func participantJurisdiction(participant *Participant) *Jurisdiction {
+	if participant == nil || !participant.Active || len(participant.Office) == 0 {
+		return nil
+	}
+	return &Jurisdiction{participant.Office, participant.Zone}
+}
+
+func (jurisdiction *Jurisdiction) covers(office string, zone string) bool {
+	if jurisdiction == nil || jurisdiction.Office != office {
+		return false
+	}
+	return len(jurisdiction.Zone) == 0 || jurisdiction.Zone == zone
+}
+
+//FILTERBYJURISDICTION: the records returned by a TARGET_LIST operation, only those of the caller's
+//jurisdiction unless a row of the matrix gives him the operation without jurisdiction
+
+func filterByJurisdiction(stub shim.ChaincodeStubInterface, operation string, chainsOfCustody []ChainOfCustody) ([]ChainOfCustody, error) {
+
+	config, caller, err := getPermissionCaller(stub, TARGET_LIST)
+	if err != nil {
+		return nil, err
+	}
+	for _, permission := range config.Permissions {
+		if permission.Operation == operation && hasAnyRole(permission.Roles, caller.Roles) && !permission.Jurisdiction {
+			return chainsOfCustody, nil
+		}
+	}
+	jurisdiction, err := caller.LoadJurisdiction()
+	if err != nil {
+		return nil, err
+	}
+	filtered := []ChainOfCustody{}
+	for _, chainOfCustody := range chainsOfCustody {
+		if jurisdiction.covers(chainOfCustody.DistributionOfficeCode, chainOfCustody.DistributionZone) {
+			filtered = append(filtered, chainOfCustody)
+		}
+	}
+	return filtered, nil
+}
@@ -1,12 +1,183 @@
 package main
 
-import "github.com/hyperledger/fabric/core/chaincode/shim"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const COC_KEY = "DCoT_ChainOfCustodyKey"
 
 func getCOCKey(stub shim.ChaincodeStubInterface, custodyId string) (string, error) {
-	cocKey, err := stub.CreateCompositeKey("DCoT_ChainOfCustodyKey", []string{custodyId})
+	cocKey, err := stub.CreateCompositeKey(COC_KEY, []string{custodyId})
 	if err != nil {
 		return "", err
 	} else {
 		return cocKey, nil
 	}
 }
+
+//GENERATECUSTODYID: the id must be the same on every endorsing peer, so it is derived from the TxID.
+//If the client supplies an idempotency key the id is derived from it instead, together with the operation
+//and the caller's identity, so that a retried transaction produces the same id and is rejected as a duplicate
+//while the same key used by another caller or for another operation produces another id.
+//index tells apart the ids created by the same transaction.
+
+func generateCustodyId(stub shim.ChaincodeStubInterface, operation string, callerUID string, idempotencyKey string, index int) string {
+	var seed string
+
+	if len(idempotencyKey) == 0 {
+		seed = "txid:" + stub.GetTxID()
+	} else {
+		seed = "key:" + operation + "\x00" + callerUID + "\x00" + idempotencyKey
+	}
+	if index > 0 {
+		seed = seed + "#" + strconv.Itoa(index)
+	}
+	hash := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(hash[:])
+}
+
+// Secondary indexes, they let the lookups run with GetStateByPartialCompositeKey also on LevelDB
+const (
+	TRACKING_ID_INDEX  = "trackingId~id"
+	DELIVERY_MAN_INDEX = "deliveryMan~status~id" // indexes the Custodian, the name is kept for the existing entries
+	OFFICE_INDEX       = "office~zone~id"
+	STATUS_INDEX       = "status~id"
+)
+
+// The pending transfers with a deadline, see getDeadlineKey. Its entries are simple keys sorted by deadline,
+// because GetStateByRange doesn't accept composite keys.
+const DEADLINE_INDEX = "DCoT_Deadline~"
+
+//GETDEADLINEKEY: the entry of the deadline index of a ChainOfCustody or a Consignment,
+//kind is its DocType and deadline a RFC3339 time in UTC, so that the keys sort by time
+
+func getDeadlineKey(deadline string, kind string, id string) string {
+	return DEADLINE_INDEX + deadline + "~" + kind + "~" + id
+}
+
+func getIndexKeys(stub shim.ChaincodeStubInterface, chainOfCustody *ChainOfCustody) ([]string, error) {
+	var indexKeys []string
+
+	if chainOfCustody == nil {
+		return indexKeys, nil
+	}
+	indexes := map[string][]string{
+		TRACKING_ID_INDEX:  {chainOfCustody.TrackingId, chainOfCustody.Id},
+		DELIVERY_MAN_INDEX: {chainOfCustody.Custodian, chainOfCustody.Status, chainOfCustody.Id},
+		OFFICE_INDEX:       {chainOfCustody.DistributionOfficeCode, chainOfCustody.DistributionZone, chainOfCustody.Id},
+		STATUS_INDEX:       {chainOfCustody.Status, chainOfCustody.Id},
+	}
+	for _, indexName := range []string{TRACKING_ID_INDEX, DELIVERY_MAN_INDEX, OFFICE_INDEX, STATUS_INDEX} {
+		indexKey, err := stub.CreateCompositeKey(indexName, indexes[indexName])
+		if err != nil {
+			return nil, err
+		}
+		indexKeys = append(indexKeys, indexKey)
+	}
+	// the parcels inside a consignment expire with it
+	if len(chainOfCustody.TransferDeadline) != 0 && len(chainOfCustody.ConsignmentId) == 0 &&
+		(chainOfCustody.Status == TRANSFER_PENDING || chainOfCustody.Status == RETURN_PENDING) {
+		indexKeys = append(indexKeys, getDeadlineKey(chainOfCustody.TransferDeadline, DOC_TYPE_CHAIN, chainOfCustody.Id))
+	}
+	return indexKeys, nil
+}
+
+//UPDATEINDEXES: must be called on every state change of a ChainOfCustody,
+//previous is nil for a new ChainOfCustody.
+//Index entries of previous that are no longer valid are removed.
+
+func updateIndexes(stub shim.ChaincodeStubInterface, previous *ChainOfCustody, current *ChainOfCustody) error {
+
+	previousKeys, err := getIndexKeys(stub, previous)
+	if err != nil {
+		return err
+	}
+	currentKeys, err := getIndexKeys(stub, current)
+	if err != nil {
+		return err
+	}
+	isCurrent := make(map[string]bool)
+	for _, indexKey := range currentKeys {
+		isCurrent[indexKey] = true
+	}
+	isPrevious := make(map[string]bool)
+	for _, indexKey := range previousKeys {
+		isPrevious[indexKey] = true
+		if !isCurrent[indexKey] {
+			err = stub.DelState(indexKey)
+			if err != nil {
+				return newError(ERR_LEDGER, "", err.Error())
+			}
+		}
+	}
+	for _, indexKey := range currentKeys {
+		if !isPrevious[indexKey] {
+			err = stub.PutState(indexKey, []byte{0x00})
+			if err != nil {
+				return newError(ERR_LEDGER, "", err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+//GETIDSBYINDEX: returns the custody ids whose index entries match the partial key
+
+func getIdsByIndex(stub shim.ChaincodeStubInterface, indexName string, attributes []string) ([]string, error) {
+	var custodyIds []string
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(indexName, attributes)
+	if err != nil {
+		return nil, newError(ERR_LEDGER, "", err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		indexEntry, err := resultsIterator.Next()
+		if err != nil {
+			return nil, newError(ERR_LEDGER, "", err.Error())
+		}
+		_, keyParts, err := stub.SplitCompositeKey(indexEntry.Key)
+		if err != nil {
+			return nil, err
+		}
+		custodyIds = append(custodyIds, keyParts[len(keyParts)-1])
+	}
+	return custodyIds, nil
+}
+
+func getParticipantKey(stub shim.ChaincodeStubInterface, uid string) (string, error) {
+	return stub.CreateCompositeKey("DCoT_ParticipantKey", []string{uid})
+}
+
+func getConsignmentKey(stub shim.ChaincodeStubInterface, consignmentId string) (string, error) {
+	return stub.CreateCompositeKey("DCoT_ConsignmentKey", []string{consignmentId})
+}
+
+// the key of the DeliveryOtp of a ChainOfCustody, the OTP hash is never stored in the record itself
+func getOtpKey(stub shim.ChaincodeStubInterface, custodyId string) (string, error) {
+	return stub.CreateCompositeKey("DCoT_OtpKey", []string{custodyId})
+}
+
+const INVESTIGATION_KEY = "DCoT_InvestigationKey"
+
+func getInvestigationKey(stub shim.ChaincodeStubInterface, custodyId string, investigationId string) (string, error) {
+	return stub.CreateCompositeKey(INVESTIGATION_KEY, []string{custodyId, investigationId})
+}
+
+func getRoleAssignmentKey(stub shim.ChaincodeStubInterface, uid string) (string, error) {
+	return stub.CreateCompositeKey("DCoT_RoleAssignmentKey", []string{uid})
+}
+
+// Immutable log of the changes of the RoleAssignments, one entry for every change
+const ROLE_AUDIT_KEY = "uid~seq"
+
+const DELEGATION_KEY = "DCoT_DelegationKey"
+
+func getDelegationKey(stub shim.ChaincodeStubInterface, delegator string, delegate string) (string, error) {
+	return stub.CreateCompositeKey(DELEGATION_KEY, []string{delegator, delegate})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestIdempotencyKeyIsScopedToCallerAndOperation(t *testing.T) {
+	var consignment Consignment
+
+	stub := newTestStub()
+	member := newCaller("m1", CALLER_ROLE_0)
+	otherMember := newCaller("m2", CALLER_ROLE_0)
+	item := `{"trackingId":"T1","documentId":"D1","weightOfParcel":2,"sortingCenterDestination":"SC1","distributionOfficeCode":"RM01"}`
+	otherItem := `{"trackingId":"T2","documentId":"D2","weightOfParcel":2,"sortingCenterDestination":"SC1","distributionOfficeCode":"RM01"}`
+
+	stub.mustInvoke(t, member, "initNewChain", item, "key-1")
+	stub.expectError(t, ERR_ALREADY_EXISTS, member, "initNewChain", item, "key-1")
+	stub.mustInvoke(t, otherMember, "initNewChain", otherItem, "key-1")
+	payload := stub.mustInvoke(t, member, "createConsignment", "key-1")
+	err := json.Unmarshal(payload, &consignment)
+	if err != nil {
+		t.Fatalf("createConsignment response: %s", string(payload))
+	}
+	_, _, _, err = loadChainOfCustody(stub, consignment.Id)
+	if chaincodeError, ok := err.(*ErrorResponse); !ok || chaincodeError.Code != ERR_NOT_FOUND {
+		t.Fatalf("the consignment has the id of a ChainOfCustody: %v", err)
+	}
+}
+
+func TestLookupsFollowTheIndexes(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+	otherOperator := newOfficeCaller("op2", CALLER_ROLE_2, "MI01")
+
+	stub.register(t, admin, operator)
+	first := stub.newChain(t, member, "T1")
+	second := stub.newChain(t, member, "T2")
+	expectLookup := func(step string, caller testCaller, function string, expected []string, args ...string) {
+		t.Helper()
+
+		var chainsOfCustody []ChainOfCustody
+
+		payload := stub.mustInvoke(t, caller, function, args...)
+		json.Unmarshal(payload, &chainsOfCustody)
+		found := make(map[string]bool)
+		for _, chainOfCustody := range chainsOfCustody {
+			found[chainOfCustody.Id] = true
+		}
+		if len(chainsOfCustody) != len(expected) {
+			t.Fatalf("%s: %s %v returned %d records, expected %v", step, function, args, len(chainsOfCustody), expected)
+		}
+		for _, custodyId := range expected {
+			if !found[custodyId] {
+				t.Fatalf("%s: %s %v misses %s", step, function, args, custodyId)
+			}
+		}
+	}
+
+	expectLookup("created", admin, "lookupByTrackingId", []string{first}, "T1")
+	expectLookup("created", admin, "lookupByDeliveryMan", []string{first, second}, "m1")
+	expectLookup("created", admin, "lookupByOffice", []string{first, second}, "RM01")
+	expectLookup("created", otherOperator, "lookupByOffice", []string{}, "RM01")
+
+	stub.mustInvoke(t, member, "startTransfer", first, "op1")
+	expectLookup("startTransfer", admin, "lookupByDeliveryMan", []string{second}, "m1", IN_CUSTODY)
+	expectLookup("startTransfer", admin, "lookupByDeliveryMan", []string{first}, "m1", TRANSFER_PENDING)
+
+	stub.mustInvoke(t, operator, "completeTrasfer", first)
+	expectLookup("completeTrasfer", admin, "lookupByDeliveryMan", []string{}, "m1", TRANSFER_PENDING)
+	expectLookup("completeTrasfer", admin, "lookupByDeliveryMan", []string{first}, "op1", IN_CUSTODY)
+	expectLookup("completeTrasfer", operator, "lookupByDeliveryMan", []string{first}, "op1")
+
+	stub.mustInvoke(t, member, "startTransfer", second, "op1")
+	stub.mustInvoke(t, member, "cancelTrasfer", second)
+	expectLookup("cancelTrasfer", admin, "lookupByDeliveryMan", []string{}, "m1", TRANSFER_PENDING)
+	expectLookup("cancelTrasfer", admin, "lookupByDeliveryMan", []string{second}, "m1", IN_CUSTODY)
+	stub.expectError(t, ERR_BAD_ARGS, admin, "lookupByOffice", "RM01", "Z1", "extra")
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//TESTSTUB: a MockStub that knows the caller's certificate, the function, the transient data
+//and the transaction time. Like the peer, it discards the writes of a failed invocation.
+//When putStateError or getStateError is set every PutState or GetState fails with it.
+
+type testStub struct {
+	*shim.MockStub
+	creator       []byte
+	function      string
+	args          []string
+	transient     map[string][]byte
+	now           time.Time
+	txCount       int
+	putStateError error
+	getStateError error
+}
+
+//TESTCALLER: the identity written in a certificate, the attributes are the ones read by cid
+
+type testCaller struct {
+	mspid string
+	attrs map[string]string
+}
+
+// the OID of the attributes added by the Fabric CA
+var attributesOid = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+var certificates = map[string][]byte{}
+
+func newTestStub() *testStub {
+	return &testStub{
+		MockStub: shim.NewMockStub("dcot", new(DcotWorkflowChaincode)),
+		now:      time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func newCaller(uid string, role string) testCaller {
+	return testCaller{"Org1MSP", map[string]string{UID: uid, ROLE: role}}
+}
+
+func newOfficeCaller(uid string, role string, office string) testCaller {
+	return testCaller{"Org1MSP", map[string]string{UID: uid, ROLE: role, OFFICE: office}}
+}
+
+func (caller testCaller) identity() string {
+	return qualifiedIdentity(caller.mspid, caller.attrs[UID])
+}
+
+func (stub *testStub) GetCreator() ([]byte, error) {
+	return stub.creator, nil
+}
+
+func (stub *testStub) GetFunctionAndParameters() (string, []string) {
+	return stub.function, stub.args
+}
+
+func (stub *testStub) GetTransient() (map[string][]byte, error) {
+	return stub.transient, nil
+}
+
+func (stub *testStub) GetState(key string) ([]byte, error) {
+	if stub.getStateError != nil {
+		return nil, stub.getStateError
+	}
+	return stub.MockStub.GetState(key)
+}
+
+func (stub *testStub) PutState(key string, value []byte) error {
+	if stub.putStateError != nil {
+		return stub.putStateError
+	}
+	return stub.MockStub.PutState(key, value)
+}
+
+//INVOKE: runs one transaction as caller, one second after the previous one
+
+func (stub *testStub) invoke(t *testing.T, caller testCaller, function string, args ...string) pb.Response {
+
+	stub.txCount++
+	stub.now = stub.now.Add(time.Second)
+	stub.creator = serializedIdentity(t, caller)
+	stub.function = function
+	stub.args = args
+
+	txId := "tx" + strconv.Itoa(stub.txCount)
+	state, keys := stub.snapshot()
+	stub.MockTransactionStart(txId)
+	stub.TxTimestamp = &timestamp.Timestamp{Seconds: stub.now.Unix()}
+	response := new(DcotWorkflowChaincode).Invoke(stub)
+	stub.MockTransactionEnd(txId)
+	if response.Status != shim.OK {
+		stub.State = state
+		stub.Keys = keys
+	}
+	stub.transient = nil
+	return response
+}
+
+func (stub *testStub) snapshot() (map[string][]byte, *list.List) {
+	state := make(map[string][]byte, len(stub.State))
+	for key, value := range stub.State {
+		state[key] = value
+	}
+	keys := list.New()
+	for element := stub.Keys.Front(); element != nil; element = element.Next() {
+		keys.PushBack(element.Value)
+	}
+	return state, keys
+}
+
+//MUSTINVOKE: fails the test if the invocation fails
+
+func (stub *testStub) mustInvoke(t *testing.T, caller testCaller, function string, args ...string) []byte {
+	t.Helper()
+
+	response := stub.invoke(t, caller, function, args...)
+	if response.Status != shim.OK {
+		t.Fatalf("%s %v: unexpected error %s", function, args, response.Message)
+	}
+	return response.Payload
+}
+
+//EXPECTERROR: fails the test unless the invocation fails with code
+
+func (stub *testStub) expectError(t *testing.T, code string, caller testCaller, function string, args ...string) {
+	t.Helper()
+
+	var errorResponse ErrorResponse
+
+	response := stub.invoke(t, caller, function, args...)
+	if response.Status == shim.OK {
+		t.Fatalf("%s %v: expected %s, it succeeded", function, args, code)
+	}
+	err := json.Unmarshal([]byte(response.Message), &errorResponse)
+	if err != nil {
+		t.Fatalf("%s %v: the error is not an ErrorResponse: %s", function, args, response.Message)
+	}
+	if errorResponse.Code != code {
+		t.Fatalf("%s %v: expected %s, got %s", function, args, code, response.Message)
+	}
+}
+
+//GETCHAIN: reads a ChainOfCustody from the world state, bypassing the permission matrix
+
+func (stub *testStub) getChain(t *testing.T, custodyId string) *ChainOfCustody {
+	t.Helper()
+
+	_, chainOfCustody, _, err := loadChainOfCustody(stub, custodyId)
+	if err != nil {
+		t.Fatalf("loadChainOfCustody %s: %s", custodyId, err.Error())
+	}
+	return chainOfCustody
+}
+
+func (stub *testStub) getConsignment(t *testing.T, consignmentId string) *Consignment {
+	t.Helper()
+
+	_, consignment, err := loadConsignment(stub, consignmentId)
+	if err != nil {
+		t.Fatalf("loadConsignment %s: %s", consignmentId, err.Error())
+	}
+	return consignment
+}
+
+//NEWCHAIN: initNewChain of a parcel of the office RM01, returns its custody id
+
+func (stub *testStub) newChain(t *testing.T, caller testCaller, trackingId string) string {
+	t.Helper()
+
+	var chainOfCustody ChainOfCustody
+
+	payload := stub.mustInvoke(t, caller, "initNewChain", `{"trackingId":"`+trackingId+`","documentId":"D`+trackingId+`","weightOfParcel":2,"sortingCenterDestination":"SC1","distributionOfficeCode":"RM01"}`)
+	err := json.Unmarshal(payload, &chainOfCustody)
+	if err != nil {
+		t.Fatalf("initNewChain: %s", err.Error())
+	}
+	return chainOfCustody.Id
+}
+
+//REGISTER: registers the caller as an active participant of the office in his certificate
+
+func (stub *testStub) register(t *testing.T, admin testCaller, caller testCaller) {
+	t.Helper()
+
+	participant := Participant{UID: caller.attrs[UID], Role: caller.attrs[ROLE], Org: caller.mspid, Office: caller.attrs[OFFICE], Active: true}
+	participantBytes, _ := json.Marshal(participant)
+	stub.mustInvoke(t, admin, "registerParticipant", string(participantBytes))
+}
+
+func sha256Hex(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
+
+func serializedIdentity(t *testing.T, caller testCaller) []byte {
+
+	attrsBytes, _ := json.Marshal(map[string]interface{}{"attrs": caller.attrs})
+	cacheKey := caller.mspid + string(attrsBytes)
+	if identityBytes, found := certificates[cacheKey]; found {
+		return identityBytes
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey: %s", err.Error())
+	}
+	template := x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: caller.attrs[UID]},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: attributesOid, Value: attrsBytes}},
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate: %s", err.Error())
+	}
+	certificatePem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate})
+	identityBytes, err := proto.Marshal(&msp.SerializedIdentity{Mspid: caller.mspid, IdBytes: certificatePem})
+	if err != nil {
+		t.Fatalf("proto.Marshal: %s", err.Error())
+	}
+	certificates[cacheKey] = identityBytes
+	return identityBytes
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//PERMISSION: one row of the permission matrix, the caller may perform Operation if his role is in Roles
+//and, when they are given, he has one of the Relations with the record and the record is in one of the Statuses.
+//With Jurisdiction the row applies only to the parcels of the caller's office and zone, see jurisdictionUtils.go.
+//An operation is allowed if at least one of its rows allows it, an operation without rows is denied to everybody.
+
+type Permission struct {
+	Operation    string   `json:"operation"`
+	Roles        []string `json:"roles"`
+	Relations    []string `json:"relations,omitempty"`
+	Statuses     []string `json:"statuses,omitempty"`
+	Jurisdiction bool     `json:"jurisdiction,omitempty"`
+}
+
+// kinds of record whose id is args[0] of an operation, the relations and the statuses of a Permission refer to it.
+// The operations on TARGET_LIST return a list of ChainOfCustody, filtered by the jurisdiction of the caller
+const (
+	TARGET_NONE        = ""
+	TARGET_CHAIN       = "ChainOfCustody"
+	TARGET_CONSIGNMENT = "Consignment"
+	TARGET_LIST        = "list"
+	RELATION_CUSTODIAN = "custodian"
+	RELATION_PENDING   = "pendingCustodian"
+)
+
+//OPERATIONTARGETS: every operation that can appear in the permission matrix, with the kind of its args[0].
+//Besides the Invoke functions there are the sub-operations checked by the handlers themselves.
+
+var operationTargets = map[string]string{
+	"initNewChain":                TARGET_NONE,
+	"initNewChainBatch":           TARGET_NONE,
+	"startTransfer":               TARGET_CHAIN,
+	"startTransferBatch":          TARGET_NONE,
+	"completeTrasfer":             TARGET_CHAIN,
+	"completeTransferBatch":       TARGET_NONE,
+	"commentChain":                TARGET_CHAIN,
+	"cancelTrasfer":               TARGET_CHAIN,
+	"rejectTransfer":              TARGET_CHAIN,
+	"terminateChain":              TARGET_CHAIN,
+	"updateDocument":              TARGET_CHAIN,
+	"getAssetDetails":             TARGET_CHAIN,
+	"getChainOfEvents":            TARGET_CHAIN,
+	"getCustodyTrail":             TARGET_CHAIN,
+	"queryByTrackingId":           TARGET_LIST,
+	"queryByDocumentId":           TARGET_LIST,
+	"queryByDeliveryMan":          TARGET_LIST,
+	"queryByStatus":               TARGET_LIST,
+	"queryBySortingCenter":        TARGET_LIST,
+	"lookupByTrackingId":          TARGET_LIST,
+	"lookupByDeliveryMan":         TARGET_LIST,
+	"lookupByOffice":              TARGET_LIST,
+	"migrateChains":               TARGET_NONE,
+	"registerParticipant":         TARGET_NONE,
+	"getParticipantDetails":       TARGET_NONE,
+	"expirePendingTransfers":      TARGET_NONE,
+	"createConsignment":           TARGET_NONE,
+	"addToConsignment":            TARGET_CONSIGNMENT,
+	"removeFromConsignment":       TARGET_CONSIGNMENT,
+	"startConsignmentTransfer":    TARGET_CONSIGNMENT,
+	"completeConsignmentTransfer": TARGET_CONSIGNMENT,
+	"cancelConsignmentTransfer":   TARGET_CONSIGNMENT,
+	"rejectConsignmentTransfer":   TARGET_CONSIGNMENT,
+	"closeConsignment":            TARGET_CONSIGNMENT,
+	"getConsignmentDetails":       TARGET_CONSIGNMENT,
+	"splitChain":                  TARGET_CHAIN,
+	"mergeChains":                 TARGET_NONE,
+	"mergeSource":                 TARGET_CHAIN,
+	"getLineage":                  TARGET_CHAIN,
+	"deliverParcel":               TARGET_CHAIN,
+	"recordDeliveryAttempt":       TARGET_CHAIN,
+	"completeReturn":              TARGET_CHAIN,
+	"setConfig":                   TARGET_NONE,
+	"raiseException":              TARGET_CHAIN,
+	"resolveInvestigation":        TARGET_CHAIN,
+	"getInvestigations":           TARGET_CHAIN,
+	"restoreException":            TARGET_CHAIN,
+	"closeAsLoss":                 TARGET_CHAIN,
+	"suspendUser":                 TARGET_NONE,
+	"reinstateUser":               TARGET_NONE,
+	"grantTemporaryRole":          TARGET_NONE,
+	"revokeTemporaryRole":         TARGET_NONE,
+	"overrideRole":                TARGET_NONE,
+	"getRoleAssignmentDetails":    TARGET_NONE,
+	"getRoleAudit":                TARGET_NONE,
+	"grantDelegation":             TARGET_NONE,
+	"revokeDelegation":            TARGET_NONE,
+	"getDelegations":              TARGET_NONE,
+	"manageDelegations":           TARGET_NONE,
+}
+
+// the roles of the people, the scheduler only runs expirePendingTransfers
+var userRoles = []string{CALLER_ROLE_0, CALLER_ROLE_1, CALLER_ROLE_2, CALLER_ROLE_3}
+var readerRoles = []string{CALLER_ROLE_1, CALLER_ROLE_2, CALLER_ROLE_3}
+var adminRoles = []string{CALLER_ROLE_1}
+var globalRoles = []string{CALLER_ROLE_0, CALLER_ROLE_1}
+var receiverRoles = []string{CALLER_ROLE_2, CALLER_ROLE_3}
+var custodianRelation = []string{RELATION_CUSTODIAN}
+var pendingCustodianRelation = []string{RELATION_PENDING}
+
+//DEFAULTPERMISSIONS: the matrix used when the ChaincodeConfig doesn't contain one.
+//Members and administrators are global, operators and delivery operators work on the parcels of their jurisdiction.
+
+var defaultPermissions = []Permission{
+	{"initNewChain", globalRoles, nil, nil, false},
+	{"initNewChainBatch", globalRoles, nil, nil, false},
+	{"startTransfer", globalRoles, custodianRelation, nil, false},
+	{"startTransfer", receiverRoles, custodianRelation, nil, true},
+	{"startTransferBatch", userRoles, nil, nil, false},
+	{"completeTrasfer", receiverRoles, pendingCustodianRelation, nil, true},
+	{"completeTransferBatch", receiverRoles, nil, nil, false},
+	{"commentChain", adminRoles, nil, nil, false},
+	{"commentChain", receiverRoles, custodianRelation, nil, true},
+	{"cancelTrasfer", adminRoles, nil, nil, false},
+	{"cancelTrasfer", []string{CALLER_ROLE_0}, custodianRelation, nil, false},
+	{"rejectTransfer", receiverRoles, pendingCustodianRelation, nil, true},
+	{"terminateChain", adminRoles, nil, nil, false},
+	{"terminateChain", []string{CALLER_ROLE_3}, custodianRelation, []string{IN_CUSTODY}, true},
+	{"updateDocument", adminRoles, nil, nil, false},
+	{"getAssetDetails", adminRoles, nil, nil, false},
+	{"getAssetDetails", receiverRoles, nil, nil, true},
+	{"getChainOfEvents", adminRoles, nil, nil, false},
+	{"getCustodyTrail", adminRoles, nil, nil, false},
+	{"getCustodyTrail", receiverRoles, nil, nil, true},
+	{"queryByTrackingId", adminRoles, nil, nil, false},
+	{"queryByTrackingId", receiverRoles, nil, nil, true},
+	{"queryByDocumentId", adminRoles, nil, nil, false},
+	{"queryByDocumentId", receiverRoles, nil, nil, true},
+	{"queryByDeliveryMan", adminRoles, nil, nil, false},
+	{"queryByDeliveryMan", receiverRoles, nil, nil, true},
+	{"queryByStatus", adminRoles, nil, nil, false},
+	{"queryByStatus", receiverRoles, nil, nil, true},
+	{"queryBySortingCenter", adminRoles, nil, nil, false},
+	{"queryBySortingCenter", receiverRoles, nil, nil, true},
+	{"lookupByTrackingId", adminRoles, nil, nil, false},
+	{"lookupByTrackingId", receiverRoles, nil, nil, true},
+	{"lookupByDeliveryMan", adminRoles, nil, nil, false},
+	{"lookupByDeliveryMan", receiverRoles, nil, nil, true},
+	{"lookupByOffice", adminRoles, nil, nil, false},
+	{"lookupByOffice", receiverRoles, nil, nil, true},
+	{"migrateChains", adminRoles, nil, nil, false},
+	{"registerParticipant", adminRoles, nil, nil, false},
+	{"getParticipantDetails", adminRoles, nil, nil, false},
+	{"expirePendingTransfers", []string{CALLER_ROLE_1, CALLER_ROLE_4}, nil, nil, false},
+	{"createConsignment", userRoles, nil, nil, false},
+	{"addToConsignment", userRoles, custodianRelation, nil, false},
+	{"removeFromConsignment", userRoles, custodianRelation, nil, false},
+	{"startConsignmentTransfer", userRoles, custodianRelation, nil, false},
+	{"completeConsignmentTransfer", receiverRoles, pendingCustodianRelation, nil, false},
+	{"cancelConsignmentTransfer", adminRoles, nil, nil, false},
+	{"cancelConsignmentTransfer", userRoles, custodianRelation, nil, false},
+	{"rejectConsignmentTransfer", receiverRoles, pendingCustodianRelation, nil, false},
+	{"closeConsignment", userRoles, custodianRelation, nil, false},
+	{"getConsignmentDetails", readerRoles, nil, nil, false},
+	{"splitChain", adminRoles, custodianRelation, nil, false},
+	{"splitChain", []string{CALLER_ROLE_2}, custodianRelation, nil, true},
+	{"mergeChains", []string{CALLER_ROLE_1, CALLER_ROLE_2}, nil, nil, false},
+	{"mergeSource", adminRoles, custodianRelation, nil, false},
+	{"mergeSource", []string{CALLER_ROLE_2}, custodianRelation, nil, true},
+	{"getLineage", adminRoles, nil, nil, false},
+	{"getLineage", receiverRoles, nil, nil, true},
+	{"deliverParcel", []string{CALLER_ROLE_3}, custodianRelation, nil, true},
+	{"recordDeliveryAttempt", []string{CALLER_ROLE_3}, custodianRelation, nil, true},
+	{"completeReturn", adminRoles, custodianRelation, nil, false},
+	{"completeReturn", []string{CALLER_ROLE_2}, custodianRelation, nil, true},
+	{"setConfig", adminRoles, nil, nil, false},
+	{"raiseException", adminRoles, nil, nil, false},
+	{"raiseException", []string{CALLER_ROLE_2}, nil, nil, true},
+	{"resolveInvestigation", adminRoles, nil, nil, false},
+	{"resolveInvestigation", []string{CALLER_ROLE_2}, nil, nil, true},
+	{"restoreException", adminRoles, nil, nil, false},
+	{"restoreException", []string{CALLER_ROLE_2}, nil, nil, true},
+	{"closeAsLoss", adminRoles, nil, nil, false},
+	{"getInvestigations", adminRoles, nil, nil, false},
+	{"getInvestigations", receiverRoles, nil, nil, true},
+	{"suspendUser", adminRoles, nil, nil, false},
+	{"reinstateUser", adminRoles, nil, nil, false},
+	{"grantTemporaryRole", adminRoles, nil, nil, false},
+	{"revokeTemporaryRole", adminRoles, nil, nil, false},
+	{"overrideRole", adminRoles, nil, nil, false},
+	{"getRoleAssignmentDetails", adminRoles, nil, nil, false},
+	{"getRoleAudit", adminRoles, nil, nil, false},
+	{"grantDelegation", userRoles, nil, nil, false},
+	{"revokeDelegation", userRoles, nil, nil, false},
+	{"getDelegations", userRoles, nil, nil, false},
+	{"manageDelegations", adminRoles, nil, nil, false},
+}
+
+//PERMISSIONSUBJECT: what the permission matrix needs to know about the record an operation works on,
+//a consignment has no office and zone
+
+type PermissionSubject struct {
+	Custodian        string
+	PendingCustodian string
+	Status           string
+	OwnerOrg         string
+	Office           string
+	Zone             string
+}
+
+//PERMISSIONCALLER: what the permission matrix needs to know about the caller, AdminOrg is the organization
+//his administrator powers are restricted to (see adminOrg), his jurisdiction is read only if a row needs it
+
+type PermissionCaller struct {
+	Roles            []string
+	Identity         string
+	AdminOrg         string
+	LoadJurisdiction func() (*Jurisdiction, error)
+	ActsFor          func(owner string) (bool, error)
+}
+
+//CHECKPERMISSION: evaluated by Invoke before the dispatch, the record is read only if
+//a row with the caller's role has relations, statuses or jurisdiction.
+
+func checkPermission(stub shim.ChaincodeStubInterface, operation string, args []string) error {
+
+	target, known := operationTargets[operation]
+	if !known {
+		return newError(ERR_UNKNOWN_FUNCTION, operation, "Invalid invoke function name")
+	}
+	config, caller, err := getPermissionCaller(stub, target)
+	if err != nil {
+		return err
+	}
+	return evaluatePermissions(config.Permissions, operation, caller, func() (*PermissionSubject, error) {
+		if target == TARGET_LIST {
+			return nil, nil
+		}
+		if len(args) == 0 {
+			return nil, newError(ERR_BAD_ARGS, operation, "the id of the "+target+" is missing!!")
+		}
+		return loadPermissionSubject(stub, target, args[0])
+	})
+}
+
+//CHECKPERMISSIONON: used by the handlers for their sub-operations, on a record already read
+
+func checkPermissionOn(stub shim.ChaincodeStubInterface, operation string, subject PermissionSubject) error {
+
+	config, caller, err := getPermissionCaller(stub, operationTargets[operation])
+	if err != nil {
+		return err
+	}
+	return evaluatePermissions(config.Permissions, operation, caller, func() (*PermissionSubject, error) {
+		return &subject, nil
+	})
+}
+
+func getPermissionCaller(stub shim.ChaincodeStubInterface, target string) (ChaincodeConfig, PermissionCaller, error) {
+
+	var caller PermissionCaller
+
+	callerRoles, callerUID, err := getCallerRoles(stub)
+	if err != nil {
+		return ChaincodeConfig{}, caller, err
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return config, caller, err
+	}
+	caller = PermissionCaller{callerRoles, callerUID, adminOrg(config, target, callerUID), func() (*Jurisdiction, error) {
+		return getCallerJurisdiction(stub, callerUID)
+	}, func(owner string) (bool, error) {
+		return actsFor(stub, callerUID, owner)
+	}}
+	return config, caller, nil
+}
+
+//EVALUATEPERMISSIONS: the caller passes if a row matches one of his roles,
+//the certificate or overridden role and the temporary ones.
+//When caller.AdminOrg is not empty the rows without relations that the caller matches only as administrator
+//apply only to the records owned by caller.AdminOrg, the records without owner are not restricted.
+//loadSubject returns nil for the operations on TARGET_LIST, their handler filters the records by jurisdiction.
+
+func evaluatePermissions(permissions []Permission, operation string, caller PermissionCaller, loadSubject func() (*PermissionSubject, error)) error {
+
+	var subject *PermissionSubject
+	var jurisdiction *Jurisdiction
+	var err error
+	roleAllowed := false
+	otherOrg := false
+	outside := false
+	subjectLoaded := false
+	jurisdictionLoaded := false
+
+	for _, permission := range permissions {
+		if permission.Operation != operation || !hasAnyRole(permission.Roles, caller.Roles) {
+			continue
+		}
+		roleAllowed = true
+		ownerOrgOnly := len(caller.AdminOrg) != 0 && len(permission.Relations) == 0 && isAdministratorOnly(permission.Roles, caller.Roles)
+		if len(permission.Relations) == 0 && len(permission.Statuses) == 0 && !ownerOrgOnly && !permission.Jurisdiction {
+			return nil
+		}
+		if !subjectLoaded {
+			subject, err = loadSubject()
+			if err != nil {
+				return err
+			}
+			subjectLoaded = true
+		}
+		if subject == nil {
+			return nil
+		}
+		if ownerOrgOnly && len(subject.OwnerOrg) != 0 && subject.OwnerOrg != caller.AdminOrg {
+			otherOrg = true
+			continue
+		}
+		if permission.Jurisdiction {
+			if !jurisdictionLoaded {
+				jurisdiction, err = caller.LoadJurisdiction()
+				if err != nil {
+					return err
+				}
+				jurisdictionLoaded = true
+			}
+			if !jurisdiction.covers(subject.Office, subject.Zone) {
+				outside = true
+				continue
+			}
+		}
+		matches, err := matchesPermission(permission, subject, caller)
+		if err != nil {
+			return err
+		}
+		if matches {
+			return nil
+		}
+	}
+	if !roleAllowed {
+		return newError(ERR_FORBIDDEN, operation, "the user's role is not compatible with this operation!!")
+	}
+	if otherOrg {
+		return newError(ERR_FORBIDDEN, operation, "the record belongs to another organization!!")
+	}
+	if outside {
+		return newError(ERR_FORBIDDEN, operation, "the parcel is outside the caller's jurisdiction!!")
+	}
+	return newError(ERR_FORBIDDEN, operation, "the caller's relation with the record or its status doesn't allow this operation!!")
+}
+
+//ADMINORG: the organization the administrator powers of the caller are restricted to,
+//empty if the configuration doesn't restrict them or the operation has no record
+
+func adminOrg(config ChaincodeConfig, target string, callerUID string) string {
+	if !config.RestrictAdminsToOwnerOrg || target == TARGET_NONE || target == TARGET_LIST {
+		return ""
+	}
+	return identityOrg(callerUID)
+}
+
+//ISADMINISTRATORONLY: true if the administrator is the only role of the caller allowed by the row
+
+func isAdministratorOnly(allowedRoles []string, callerRoles []string) bool {
+	for _, role := range callerRoles {
+		if role != CALLER_ROLE_1 && containsString(allowedRoles, role) {
+			return false
+		}
+	}
+	return containsString(allowedRoles, CALLER_ROLE_1)
+}
+
+//MATCHESPERMISSION: the relations are satisfied also by a delegate of the custodian or of the pending custodian
+
+func matchesPermission(permission Permission, subject *PermissionSubject, caller PermissionCaller) (bool, error) {
+
+	if len(permission.Statuses) != 0 && !containsString(permission.Statuses, subject.Status) {
+		return false, nil
+	}
+	if len(permission.Relations) == 0 {
+		return true, nil
+	}
+	if len(caller.Identity) == 0 {
+		return false, nil
+	}
+	if containsString(permission.Relations, RELATION_CUSTODIAN) {
+		delegated, err := caller.ActsFor(subject.Custodian)
+		if err != nil || delegated {
+			return delegated, err
+		}
+	}
+	if containsString(permission.Relations, RELATION_PENDING) {
+		return caller.ActsFor(subject.PendingCustodian)
+	}
+	return false, nil
+}
+
+func loadPermissionSubject(stub shim.ChaincodeStubInterface, target string, id string) (*PermissionSubject, error) {
+
+	if target == TARGET_CONSIGNMENT {
+		_, consignment, err := loadConsignment(stub, id)
+		if err != nil {
+			return nil, err
+		}
+		return &PermissionSubject{consignment.Custodian, consignment.PendingCustodian, consignment.Status, consignment.OwnerOrg, "", ""}, nil
+	}
+	_, chainOfCustody, _, err := loadChainOfCustody(stub, id)
+	if err != nil {
+		return nil, err
+	}
+	subject := chainPermissionSubject(chainOfCustody)
+	return &subject, nil
+}
+
+func chainPermissionSubject(chainOfCustody *ChainOfCustody) PermissionSubject {
+	return PermissionSubject{chainOfCustody.Custodian, chainOfCustody.PendingCustodian, chainOfCustody.Status, chainOfCustody.OwnerOrg, chainOfCustody.DistributionOfficeCode, chainOfCustody.DistributionZone}
+}
+
+//ISROLEALLOWED: true if at least one row of the matrix gives the operation to one of the roles,
+//whatever its relations with the record
+
+func isRoleAllowed(permissions []Permission, operation string, roles ...string) bool {
+	for _, permission := range permissions {
+		if permission.Operation == operation && hasAnyRole(permission.Roles, roles) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyRole(allowedRoles []string, roles []string) bool {
+	for _, role := range roles {
+		if containsString(allowedRoles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+//CHECKPERMISSIONS: validates a permission matrix before it's stored, setConfig must stay reachable
+
+func checkPermissions(permissions []Permission) error {
+
+	fieldErrors := []FieldError{}
+
+	for index, permission := range permissions {
+		field := "permissions[" + strconv.Itoa(index) + "]"
+		target, known := operationTargets[permission.Operation]
+		if !known {
+			fieldErrors = append(fieldErrors, FieldError{field, "unknown operation " + permission.Operation})
+			continue
+		}
+		if len(permission.Roles) == 0 {
+			fieldErrors = append(fieldErrors, FieldError{field, "roles must not be empty"})
+		}
+		for _, role := range permission.Roles {
+			if !containsString(allRoles, role) {
+				fieldErrors = append(fieldErrors, FieldError{field, "unknown role " + role})
+			}
+		}
+		if (target == TARGET_NONE || target == TARGET_LIST) && (len(permission.Relations) != 0 || len(permission.Statuses) != 0) {
+			fieldErrors = append(fieldErrors, FieldError{field, permission.Operation + " has no record, relations and statuses can't be used"})
+		}
+		if permission.Jurisdiction && target != TARGET_CHAIN && target != TARGET_LIST {
+			fieldErrors = append(fieldErrors, FieldError{field, permission.Operation + " doesn't work on parcels, jurisdiction can't be used"})
+		}
+		for _, relation := range permission.Relations {
+			if relation != RELATION_CUSTODIAN && relation != RELATION_PENDING {
+				fieldErrors = append(fieldErrors, FieldError{field, "unknown relation " + relation})
+			}
+		}
+	}
+	if len(fieldErrors) == 0 && !isRoleAllowed(permissions, "setConfig", CALLER_ROLE_1) {
+		fieldErrors = append(fieldErrors, FieldError{"permissions", "setConfig must be allowed to the " + CALLER_ROLE_1})
+	}
+	if len(fieldErrors) != 0 {
+		permissionError := newError(ERR_BAD_ARGS, "", "the permission matrix is not valid!!")
+		permissionError.Details = fieldErrors
+		return permissionError
+	}
+	return nil
+}
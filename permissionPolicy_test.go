@@ -0,0 +1,171 @@
+package main
+
+import (
+	"testing"
+)
+
+//PERMISSIONTEST: evaluates rows of the matrix for a caller on a record, without a ledger
+
+type permissionTest struct {
+	name         string
+	operation    string
+	permissions  []Permission
+	caller       PermissionCaller
+	subject      *PermissionSubject
+	expectedCode string
+}
+
+func testPermissionCaller(identity string, jurisdiction *Jurisdiction, roles ...string) PermissionCaller {
+	return PermissionCaller{
+		Roles:            roles,
+		Identity:         identity,
+		LoadJurisdiction: func() (*Jurisdiction, error) { return jurisdiction, nil },
+		ActsFor: func(owner string) (bool, error) {
+			return len(owner) != 0 && owner == identity, nil
+		},
+	}
+}
+
+func TestEvaluatePermissions(t *testing.T) {
+	rm01 := &Jurisdiction{Office: "RM01"}
+	rm01Zone1 := &Jurisdiction{Office: "RM01", Zone: "Z1"}
+	parcel := &PermissionSubject{Custodian: "Org1MSP/d1", PendingCustodian: "Org1MSP/d2", Status: IN_CUSTODY, OwnerOrg: "Org1MSP", Office: "RM01", Zone: "Z2"}
+
+	tests := []permissionTest{
+		{"role only", "getAssetDetails",
+			[]Permission{{"getAssetDetails", []string{CALLER_ROLE_0}, nil, nil, false}},
+			testPermissionCaller("Org1MSP/m1", nil, CALLER_ROLE_0), parcel, ""},
+		{"other role", "getAssetDetails",
+			[]Permission{{"getAssetDetails", []string{CALLER_ROLE_0}, nil, nil, false}},
+			testPermissionCaller("Org1MSP/d1", nil, CALLER_ROLE_3), parcel, ERR_FORBIDDEN},
+		{"temporary role", "getAssetDetails",
+			[]Permission{{"getAssetDetails", []string{CALLER_ROLE_2}, nil, nil, false}},
+			testPermissionCaller("Org1MSP/d1", nil, CALLER_ROLE_3, CALLER_ROLE_2), parcel, ""},
+		{"no rows", "getAssetDetails",
+			[]Permission{{"commentChain", []string{CALLER_ROLE_0}, nil, nil, false}},
+			testPermissionCaller("Org1MSP/m1", nil, CALLER_ROLE_0), parcel, ERR_FORBIDDEN},
+		{"custodian", "startTransfer",
+			[]Permission{{"startTransfer", []string{CALLER_ROLE_3}, custodianRelation, nil, false}},
+			testPermissionCaller("Org1MSP/d1", nil, CALLER_ROLE_3), parcel, ""},
+		{"not the custodian", "startTransfer",
+			[]Permission{{"startTransfer", []string{CALLER_ROLE_3}, custodianRelation, nil, false}},
+			testPermissionCaller("Org1MSP/d2", nil, CALLER_ROLE_3), parcel, ERR_FORBIDDEN},
+		{"pending custodian", "completeTrasfer",
+			[]Permission{{"completeTrasfer", []string{CALLER_ROLE_3}, pendingCustodianRelation, nil, false}},
+			testPermissionCaller("Org1MSP/d2", nil, CALLER_ROLE_3), parcel, ""},
+		{"custodian is not the pending custodian", "completeTrasfer",
+			[]Permission{{"completeTrasfer", []string{CALLER_ROLE_3}, pendingCustodianRelation, nil, false}},
+			testPermissionCaller("Org1MSP/d1", nil, CALLER_ROLE_3), parcel, ERR_FORBIDDEN},
+		{"status listed", "terminateChain",
+			[]Permission{{"terminateChain", []string{CALLER_ROLE_3}, custodianRelation, []string{IN_CUSTODY}, false}},
+			testPermissionCaller("Org1MSP/d1", nil, CALLER_ROLE_3), parcel, ""},
+		{"status not listed", "terminateChain",
+			[]Permission{{"terminateChain", []string{CALLER_ROLE_3}, custodianRelation, []string{RETURN_TO_SENDER}, false}},
+			testPermissionCaller("Org1MSP/d1", nil, CALLER_ROLE_3), parcel, ERR_FORBIDDEN},
+		{"inside the jurisdiction", "getAssetDetails",
+			[]Permission{{"getAssetDetails", []string{CALLER_ROLE_2}, nil, nil, true}},
+			testPermissionCaller("Org1MSP/op1", rm01, CALLER_ROLE_2), parcel, ""},
+		{"outside the zone", "getAssetDetails",
+			[]Permission{{"getAssetDetails", []string{CALLER_ROLE_2}, nil, nil, true}},
+			testPermissionCaller("Org1MSP/op1", rm01Zone1, CALLER_ROLE_2), parcel, ERR_FORBIDDEN},
+		{"without jurisdiction", "getAssetDetails",
+			[]Permission{{"getAssetDetails", []string{CALLER_ROLE_2}, nil, nil, true}},
+			testPermissionCaller("Org1MSP/op1", nil, CALLER_ROLE_2), parcel, ERR_FORBIDDEN},
+		{"a global row wins over a jurisdiction row", "getAssetDetails",
+			[]Permission{{"getAssetDetails", []string{CALLER_ROLE_2}, nil, nil, true}, {"getAssetDetails", []string{CALLER_ROLE_2}, custodianRelation, nil, false}},
+			testPermissionCaller("Org1MSP/d1", nil, CALLER_ROLE_2), parcel, ""},
+		{"lists are filtered by the handler", "queryByStatus",
+			[]Permission{{"queryByStatus", []string{CALLER_ROLE_2}, nil, nil, true}},
+			testPermissionCaller("Org1MSP/op1", nil, CALLER_ROLE_2), nil, ""},
+		{"administrator of another organization", "commentChain",
+			[]Permission{{"commentChain", adminRoles, nil, nil, false}},
+			PermissionCaller{Roles: adminRoles, Identity: "Org2MSP/adm", AdminOrg: "Org2MSP"}, parcel, ERR_FORBIDDEN},
+		{"administrator of the owner organization", "commentChain",
+			[]Permission{{"commentChain", adminRoles, nil, nil, false}},
+			PermissionCaller{Roles: adminRoles, Identity: "Org1MSP/adm", AdminOrg: "Org1MSP"}, parcel, ""},
+	}
+	for _, test := range tests {
+		subject := test.subject
+		err := evaluatePermissions(test.permissions, test.operation, test.caller, func() (*PermissionSubject, error) {
+			return subject, nil
+		})
+		if len(test.expectedCode) == 0 && err != nil {
+			t.Errorf("%s: unexpected error %s", test.name, err.Error())
+		}
+		if len(test.expectedCode) != 0 {
+			chaincodeError, ok := err.(*ErrorResponse)
+			if !ok || chaincodeError.Code != test.expectedCode {
+				t.Errorf("%s: expected %s, got %v", test.name, test.expectedCode, err)
+			}
+		}
+	}
+}
+
+func TestCheckPermissionsRejectsInvalidRows(t *testing.T) {
+	setConfigRow := Permission{"setConfig", adminRoles, nil, nil, false}
+	invalid := map[string][]Permission{
+		"unknown operation":       {setConfigRow, {"fly", adminRoles, nil, nil, false}},
+		"no roles":                {setConfigRow, {"getAssetDetails", nil, nil, nil, false}},
+		"relation without record": {setConfigRow, {"initNewChain", adminRoles, custodianRelation, nil, false}},
+		"status of a list":        {setConfigRow, {"queryByStatus", adminRoles, nil, []string{IN_CUSTODY}, false}},
+		"unknown relation":        {setConfigRow, {"getAssetDetails", adminRoles, []string{"owner"}, nil, false}},
+		"unknown role":            {setConfigRow, {"getAssetDetails", []string{"auditor"}, nil, nil, false}},
+		"jurisdiction of a bag":   {setConfigRow, {"closeConsignment", adminRoles, nil, nil, true}},
+		"setConfig unreachable":   {{"setConfig", []string{CALLER_ROLE_0}, nil, nil, false}},
+	}
+	for name, permissions := range invalid {
+		err := checkPermissions(permissions)
+		chaincodeError, ok := err.(*ErrorResponse)
+		if !ok || chaincodeError.Code != ERR_BAD_ARGS {
+			t.Errorf("%s: expected %s, got %v", name, ERR_BAD_ARGS, err)
+		}
+	}
+	err := checkPermissions(defaultPermissions)
+	if err != nil {
+		t.Errorf("defaultPermissions: %s", err.Error())
+	}
+}
+
+func TestCheckPermissionBeforeDispatch(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+	otherOperator := newOfficeCaller("op2", CALLER_ROLE_2, "MI01")
+	delivery := newOfficeCaller("d1", CALLER_ROLE_3, "RM01")
+
+	stub.register(t, admin, operator)
+	stub.register(t, admin, delivery)
+	custodyId := stub.newChain(t, member, "T1")
+
+	stub.expectError(t, ERR_FORBIDDEN, delivery, "initNewChain", `{}`)
+	stub.expectError(t, ERR_UNKNOWN_FUNCTION, member, "fly", custodyId)
+	stub.expectError(t, ERR_NOT_FOUND, member, "startTransfer", "missing", "op1")
+	stub.mustInvoke(t, operator, "getAssetDetails", custodyId)
+	stub.expectError(t, ERR_FORBIDDEN, otherOperator, "getAssetDetails", custodyId)
+	stub.expectError(t, ERR_FORBIDDEN, operator, "startTransfer", custodyId, "d1")
+
+	stub.mustInvoke(t, member, "startTransfer", custodyId, "op1")
+	stub.expectError(t, ERR_FORBIDDEN, delivery, "completeTrasfer", custodyId)
+	stub.mustInvoke(t, operator, "completeTrasfer", custodyId)
+	if custodian := stub.getChain(t, custodyId).Custodian; custodian != operator.identity() {
+		t.Fatalf("custodian after completeTrasfer: %s", custodian)
+	}
+}
+
+func TestSchedulerOnlyExpiresTransfers(t *testing.T) {
+	for _, permission := range defaultPermissions {
+		if containsString(permission.Roles, CALLER_ROLE_4) && permission.Operation != "expirePendingTransfers" {
+			t.Errorf("the scheduler is allowed to run %s", permission.Operation)
+		}
+	}
+
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	scheduler := newCaller("cron", CALLER_ROLE_4)
+
+	stub.register(t, admin, scheduler)
+	stub.mustInvoke(t, scheduler, "expirePendingTransfers")
+	stub.expectError(t, ERR_FORBIDDEN, scheduler, "createConsignment", `{}`)
+	stub.expectError(t, ERR_FORBIDDEN, scheduler, "grantDelegation", "Org1MSP/m1", "2026-01-01T00:00:00Z", "2026-02-01T00:00:00Z")
+}
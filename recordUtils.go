@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//LOADRECORD: reads the json stored with key into record, the ErrorResponse tells apart
+//a missing record (NOT_FOUND), a record that can't be decoded (CORRUPT_RECORD)
+//and a failure of the world state (LEDGER_ERROR). kind and id are only for the message.
+
+func loadRecord(stub shim.ChaincodeStubInterface, key string, kind string, id string, record interface{}) error {
+
+	recordBytes, err := stub.GetState(key)
+	if err != nil {
+		return newError(ERR_LEDGER, "", "GetState() of "+kind+" "+id+" failed: "+err.Error())
+	}
+	if recordBytes == nil {
+		return newError(ERR_NOT_FOUND, "", kind+" "+id+" not found")
+	}
+	err = json.Unmarshal(recordBytes, record)
+	if err != nil {
+		return newError(ERR_CORRUPT_RECORD, "", kind+" "+id+" can't be decoded: "+err.Error())
+	}
+	return nil
+}
+
+//RECORDEXISTS: true if something is stored with key
+
+func recordExists(stub shim.ChaincodeStubInterface, key string) (bool, error) {
+
+	recordBytes, err := stub.GetState(key)
+	if err != nil {
+		return false, newError(ERR_LEDGER, "", "GetState() failed: "+err.Error())
+	}
+	return recordBytes != nil, nil
+}
+
+//LOADCHAINOFCUSTODY: returns the key and the ChainOfCustody stored with custodyId,
+//already moved to the current layout, and the record as it was stored
+
+func loadChainOfCustody(stub shim.ChaincodeStubInterface, custodyId string) (string, *ChainOfCustody, ChainOfCustody, error) {
+	var chainOfCustody ChainOfCustody
+
+	COCKey, err := getCOCKey(stub, custodyId)
+	if err != nil {
+		return "", nil, chainOfCustody, newError(ERR_BAD_ARGS, "", err.Error())
+	}
+	err = loadRecord(stub, COCKey, "ChainOfCustody", custodyId, &chainOfCustody)
+	if err != nil {
+		return "", nil, chainOfCustody, err
+	}
+	previous := migrateChainOfCustody(&chainOfCustody)
+	return COCKey, &chainOfCustody, previous, nil
+}
+
+//STORECHAINOFCUSTODY: records the operation in the event log of current
+//and writes it with its index entries, previous is the record as it was stored.
+//The OTP hash of a legacy record is moved out of it, see storeLegacyOtp.
+
+func storeChainOfCustody(stub shim.ChaincodeStubInterface, COCKey string, previous *ChainOfCustody, current *ChainOfCustody, operation string, callerUID string, callerRole string, args []string) ([]byte, error) {
+
+	var err error
+
+	err = storeLegacyOtp(stub, current)
+	if err != nil {
+		return nil, err
+	}
+	current.Event, err = createEvent(stub, callerUID, callerRole, operation)
+	if err != nil {
+		return nil, err
+	}
+	err = appendCustodyEvent(stub, previous, current, args)
+	if err != nil {
+		return nil, err
+	}
+	byteCOC, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.PutState(COCKey, byteCOC)
+	if err != nil {
+		return nil, newError(ERR_LEDGER, "", err.Error())
+	}
+	err = updateIndexes(stub, previous, current)
+	if err != nil {
+		return nil, err
+	}
+	return byteCOC, nil
+}
+
+//STORENEWCHAINOFCUSTODY: sets status, custodian, owner organization and event of a new ChainOfCustody,
+//whose Id is already generated, and writes it with its event log and index entries.
+//The operation creating the record is initNewChain, splitChain or mergeChains; the custodian is the caller
+//or, when a delegate splits or merges, the custodian of the parcels he acts for
+
+func storeNewChainOfCustody(stub shim.ChaincodeStubInterface, COCKey string, chainOfCustody *ChainOfCustody, operation string, custodian string, callerUID string, callerRole string, args []string) ([]byte, error) {
+
+	var err error
+
+	chainOfCustody.Status, err = applyTransition(operation, NO_CHAIN)
+	if err != nil {
+		return nil, err
+	}
+	chainOfCustody.DocType = DOC_TYPE_CHAIN
+	chainOfCustody.Custodian = custodian
+	chainOfCustody.PendingCustodian = ""
+	chainOfCustody.OwnerOrg = identityOrg(custodian)
+	chainOfCustody.Event, err = createEvent(stub, callerUID, callerRole, operation)
+	if err != nil {
+		return nil, err
+	}
+	err = appendCustodyEvent(stub, nil, chainOfCustody, args)
+	if err != nil {
+		return nil, err
+	}
+	byteCOC, err := json.Marshal(chainOfCustody)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.PutState(COCKey, byteCOC)
+	if err != nil {
+		return nil, newError(ERR_LEDGER, "", err.Error())
+	}
+	err = updateIndexes(stub, nil, chainOfCustody)
+	if err != nil {
+		return nil, err
+	}
+	return byteCOC, nil
+}
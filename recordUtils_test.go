@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLoadRecordTellsTheFailuresApart(t *testing.T) {
+	var chainOfCustody ChainOfCustody
+
+	stub := newTestStub()
+	stub.MockTransactionStart("setup")
+	stub.PutState("good", []byte(`{"id":"good"}`))
+	stub.PutState("corrupt", []byte(`{"id":`))
+	stub.MockTransactionEnd("setup")
+
+	expectCode := func(key string, code string) {
+		t.Helper()
+		err := loadRecord(stub, key, "ChainOfCustody", key, &chainOfCustody)
+		if chaincodeError, ok := err.(*ErrorResponse); !ok || chaincodeError.Code != code {
+			t.Fatalf("loadRecord %s: expected %s, got %v", key, code, err)
+		}
+	}
+	expectCode("missing", ERR_NOT_FOUND)
+	expectCode("corrupt", ERR_CORRUPT_RECORD)
+	stub.getStateError = errors.New("peer unreachable")
+	expectCode("good", ERR_LEDGER)
+	stub.getStateError = nil
+	if err := loadRecord(stub, "good", "ChainOfCustody", "good", &chainOfCustody); err != nil || chainOfCustody.Id != "good" {
+		t.Fatalf("loadRecord good: %+v %v", chainOfCustody, err)
+	}
+}
+
+func TestHandlersReportMissingAndCorruptRecords(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+
+	stub.register(t, admin, operator)
+	custodyId := stub.newChain(t, member, "T1")
+	COCKey, _ := getCOCKey(stub, custodyId)
+	stub.MockTransactionStart("corrupt")
+	stub.PutState(COCKey, []byte(`{"id":`))
+	stub.MockTransactionEnd("corrupt")
+
+	handlers := []struct {
+		caller   testCaller
+		function string
+		args     []string
+	}{
+		{member, "startTransfer", []string{"op1"}},
+		{operator, "completeTrasfer", nil},
+		{operator, "rejectTransfer", nil},
+		{admin, "commentChain", []string{"text"}},
+		{admin, "cancelTrasfer", nil},
+		{admin, "terminateChain", nil},
+		{admin, "updateDocument", []string{"D2"}},
+		{admin, "getAssetDetails", nil},
+	}
+	for _, handler := range handlers {
+		stub.expectError(t, ERR_NOT_FOUND, handler.caller, handler.function, append([]string{"missing"}, handler.args...)...)
+		stub.expectError(t, ERR_CORRUPT_RECORD, handler.caller, handler.function, append([]string{custodyId}, handler.args...)...)
+	}
+}
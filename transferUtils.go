@@ -0,0 +1,128 @@
+package main
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//PREPARESTARTTRANSFER: checks that the caller, the custodian or his delegate, can hand the ChainOfCustody
+//over to the receiver and sets the PendingCustodian, deadline is empty or a RFC3339 time.
+//A bare receiver UID is in the caller's organization, see resolveIdentity.
+//consignmentId is empty unless the whole consignment containing the ChainOfCustody is transferred.
+//Nothing is written to the ledger.
+
+func prepareStartTransfer(stub shim.ChaincodeStubInterface, chainOfCustody *ChainOfCustody, callerUID string, callerRole string, receiver string, deadline string, consignmentId string) error {
+
+	var err error
+	operation := "startTransfer"
+
+	err = checkConsignment(chainOfCustody, operation, consignmentId)
+	if err != nil {
+		return err
+	}
+	delegated, err := actsFor(stub, callerUID, chainOfCustody.Custodian)
+	if err != nil {
+		return err
+	}
+	if !delegated {
+		return newError(ERR_FORBIDDEN, operation, "The caller must be the current custodian!!")
+	}
+	chainOfCustody.Status, err = applyTransition(operation, chainOfCustody.Status)
+	if err != nil {
+		return err
+	}
+	chainOfCustody.PendingCustodian = resolveIdentity(callerUID, receiver)
+	subject := chainPermissionSubject(chainOfCustody)
+	err = checkReceiver(stub, operation, chainOfCustody.PendingCustodian, &subject)
+	if err != nil {
+		return err
+	}
+	chainOfCustody.TransferDeadline, err = checkDeadline(stub, operation, deadline)
+	return err
+}
+
+//CHECKDEADLINE: deadline is empty or a RFC3339 time after the transaction timestamp,
+//returns it in UTC
+
+func checkDeadline(stub shim.ChaincodeStubInterface, operation string, deadline string) (string, error) {
+
+	if len(deadline) == 0 {
+		return "", nil
+	}
+	deadlineTime, err := time.Parse(time.RFC3339, deadline)
+	if err != nil {
+		return "", newError(ERR_BAD_ARGS, operation, "the deadline must be a RFC3339 time!!")
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return "", err
+	}
+	if !deadlineTime.After(txTime) {
+		return "", newError(ERR_BAD_ARGS, operation, "the deadline is already expired!!")
+	}
+	return deadlineTime.UTC().Format(time.RFC3339), nil
+}
+
+//PREPARECOMPLETETRANSFER: checks that the caller is the designed receiver or his delegate
+//and makes the receiver the Custodian. Nothing is written to the ledger.
+
+func prepareCompleteTransfer(stub shim.ChaincodeStubInterface, chainOfCustody *ChainOfCustody, callerUID string, callerRole string, consignmentId string) error {
+
+	var err error
+	operation := "completeTrasfer"
+
+	err = checkConsignment(chainOfCustody, operation, consignmentId)
+	if err != nil {
+		return err
+	}
+	delegated, err := actsFor(stub, callerUID, chainOfCustody.PendingCustodian)
+	if err != nil {
+		return err
+	}
+	if !delegated {
+		return newError(ERR_FORBIDDEN, operation, "The caller must be the designed receiver!!")
+	}
+	chainOfCustody.Status, err = applyTransition(operation, chainOfCustody.Status)
+	if err != nil {
+		return err
+	}
+	chainOfCustody.Custodian = chainOfCustody.PendingCustodian
+	chainOfCustody.PendingCustodian = ""
+	chainOfCustody.TransferDeadline = ""
+	return nil
+}
+
+//PREPAREENDTRANSFER: the pending transfer of a ChainOfCustody inside the consignment is cancelled, rejected or expired
+//with the consignment, operation is the one of the single parcel. Nothing is written to the ledger.
+
+func prepareEndTransfer(chainOfCustody *ChainOfCustody, operation string, consignmentId string) error {
+
+	var err error
+
+	err = checkConsignment(chainOfCustody, operation, consignmentId)
+	if err != nil {
+		return err
+	}
+	chainOfCustody.Status, err = applyTransition(operation, chainOfCustody.Status)
+	if err != nil {
+		return err
+	}
+	chainOfCustody.PendingCustodian = ""
+	chainOfCustody.TransferDeadline = ""
+	return nil
+}
+
+//CHECKCONSIGNMENT: a ChainOfCustody inside a consignment moves only with the consignment,
+//consignmentId is empty when the operation is not done on a consignment
+
+func checkConsignment(chainOfCustody *ChainOfCustody, operation string, consignmentId string) error {
+
+	if chainOfCustody.ConsignmentId == consignmentId {
+		return nil
+	}
+	if len(chainOfCustody.ConsignmentId) != 0 {
+		return newError(ERR_INVALID_STATE, operation, "the parcel is inside the consignment "+chainOfCustody.ConsignmentId+"!!")
+	}
+	return newError(ERR_INVALID_STATE, operation, "the parcel is not inside the consignment "+consignmentId+"!!")
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRejectTransferReturnsTheParcelToTheCustodian(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+	operator := newOfficeCaller("op1", CALLER_ROLE_2, "RM01")
+	otherOperator := newOfficeCaller("op2", CALLER_ROLE_2, "RM01")
+
+	stub.register(t, admin, operator)
+	stub.register(t, admin, otherOperator)
+	custodyId := stub.newChain(t, member, "T1")
+	expectCustody := func(step string, custodian testCaller) {
+		t.Helper()
+		chainOfCustody := stub.getChain(t, custodyId)
+		if chainOfCustody.Status != IN_CUSTODY || chainOfCustody.Custodian != custodian.identity() || len(chainOfCustody.PendingCustodian) != 0 || chainOfCustody.Event.Operation != "rejectTransfer" {
+			t.Fatalf("after %s: status %s, custodian %s, pending %q, operation %s", step, chainOfCustody.Status, chainOfCustody.Custodian, chainOfCustody.PendingCustodian, chainOfCustody.Event.Operation)
+		}
+	}
+
+	stub.expectError(t, ERR_FORBIDDEN, operator, "rejectTransfer", custodyId)
+	stub.mustInvoke(t, member, "startTransfer", custodyId, "op1")
+	stub.expectError(t, ERR_FORBIDDEN, member, "rejectTransfer", custodyId)
+	stub.expectError(t, ERR_FORBIDDEN, otherOperator, "rejectTransfer", custodyId)
+	stub.mustInvoke(t, operator, "rejectTransfer", custodyId)
+	expectCustody("the first rejectTransfer", member)
+	stub.expectError(t, ERR_FORBIDDEN, operator, "completeTrasfer", custodyId)
+
+	stub.mustInvoke(t, member, "startTransfer", custodyId, "op1")
+	stub.mustInvoke(t, operator, "completeTrasfer", custodyId)
+	stub.mustInvoke(t, operator, "startTransfer", custodyId, "op2")
+	stub.mustInvoke(t, otherOperator, "rejectTransfer", custodyId)
+	expectCustody("the second rejectTransfer", operator)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//FieldError: one violation found in a client-supplied payload, Field is the json name
+
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+//Fields a client may supply when creating a ChainOfCustody, the others are managed by the chaincode
+
+var NEW_CHAIN_FIELDS = []string{"trackingId", "documentId", "weightOfParcel", "sortingCenterDestination", "distributionOfficeCode", "distributionZone", "codeOwner", "text"}
+var NEW_CHAIN_REQUIRED_FIELDS = []string{"trackingId", "documentId", "weightOfParcel", "sortingCenterDestination", "distributionOfficeCode"}
+var SPLIT_CHILD_FIELDS = []string{"trackingId", "weightOfParcel"}
+var MERGED_CHAIN_FIELDS = []string{"trackingId", "documentId", "sortingCenterDestination", "distributionOfficeCode", "distributionZone", "codeOwner", "text"}
+
+var trackingIdRegexp = regexp.MustCompile(TRACKING_ID_PATTERN)
+var documentIdRegexp = regexp.MustCompile(DOCUMENT_ID_PATTERN)
+var sortingCenterRegexp = regexp.MustCompile(SORTING_CENTER_PATTERN)
+var officeCodeRegexp = regexp.MustCompile(OFFICE_CODE_PATTERN)
+var zoneRegexp = regexp.MustCompile(ZONE_PATTERN)
+
+//DECODECHAINOFCUSTODY: decodes a client-supplied ChainOfCustody json accepting only the allowed fields,
+//the fields managed by the chaincode (id, status, custodian, event...) and the unknown ones are rejected,
+//the required ones must be present and every value must respect its format.
+//All the violations are returned together, sorted by field.
+
+func decodeChainOfCustody(payload []byte, allowed []string, required []string) (ChainOfCustody, []FieldError) {
+
+	var chainOfCustody ChainOfCustody
+	var fields map[string]json.RawMessage
+	var names []string
+
+	fieldErrors := []FieldError{}
+
+	err := json.Unmarshal(payload, &fields)
+	if err != nil || fields == nil {
+		return chainOfCustody, []FieldError{{"", "the ChainOfCustody must be a json object"}}
+	}
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !containsString(allowed, name) {
+			if isChainOfCustodyField(name) {
+				fieldErrors = append(fieldErrors, FieldError{name, "is managed by the chaincode and must not be supplied"})
+			} else {
+				fieldErrors = append(fieldErrors, FieldError{name, "unknown field"})
+			}
+			continue
+		}
+		single, _ := json.Marshal(map[string]json.RawMessage{name: fields[name]})
+		err = json.Unmarshal(single, &chainOfCustody)
+		if err != nil {
+			fieldErrors = append(fieldErrors, FieldError{name, "has a wrong type"})
+			continue
+		}
+		message := checkChainOfCustodyField(&chainOfCustody, name, containsString(required, name))
+		if len(message) != 0 {
+			fieldErrors = append(fieldErrors, FieldError{name, message})
+		}
+	}
+	for _, name := range required {
+		if _, found := fields[name]; !found {
+			fieldErrors = append(fieldErrors, FieldError{name, "is required"})
+		}
+	}
+	sort.SliceStable(fieldErrors, func(i, j int) bool {
+		return fieldErrors[i].Field < fieldErrors[j].Field
+	})
+	return chainOfCustody, fieldErrors
+}
+
+//CHECKCHAINOFCUSTODYFIELD: returns why the value of the field is not valid, empty if it is.
+//An empty string is accepted only when the field is not required.
+
+func checkChainOfCustodyField(chainOfCustody *ChainOfCustody, name string, required bool) string {
+
+	var value string
+	var pattern *regexp.Regexp
+
+	switch name {
+	case "weightOfParcel":
+		if chainOfCustody.WeightOfParcel <= 0 {
+			return "must be greater than 0"
+		}
+		return ""
+	case "codeOwner":
+		if len(chainOfCustody.CodeOwner) > 64 {
+			return "must not be longer than 64 characters"
+		}
+		value = chainOfCustody.CodeOwner
+	case "text":
+		if len(chainOfCustody.Text) > MAX_TEXT_LENGTH {
+			return "is too long"
+		}
+		value = chainOfCustody.Text
+	case "trackingId":
+		value, pattern = chainOfCustody.TrackingId, trackingIdRegexp
+	case "documentId":
+		value, pattern = chainOfCustody.DocumentId, documentIdRegexp
+	case "sortingCenterDestination":
+		value, pattern = chainOfCustody.SortingCenterDestination, sortingCenterRegexp
+	case "distributionOfficeCode":
+		value, pattern = chainOfCustody.DistributionOfficeCode, officeCodeRegexp
+	case "distributionZone":
+		value, pattern = chainOfCustody.DistributionZone, zoneRegexp
+	}
+	if len(value) == 0 {
+		if required {
+			return "must not be empty"
+		}
+		return ""
+	}
+	if pattern != nil && !pattern.MatchString(value) {
+		return "must match " + pattern.String()
+	}
+	return ""
+}
+
+//ISCHAINOFCUSTODYFIELD: true if name is the json name of a field of ChainOfCustody
+
+func isChainOfCustodyField(name string) bool {
+
+	chainOfCustodyType := reflect.TypeOf(ChainOfCustody{})
+	for index := 0; index < chainOfCustodyType.NumField(); index++ {
+		tag := chainOfCustodyType.Field(index).Tag.Get("json")
+		if strings.Split(tag, ",")[0] == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, current := range values {
+		if current == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDecodeChainOfCustodyReportsEveryViolation(t *testing.T) {
+	_, fieldErrors := decodeChainOfCustody([]byte(`{"id":"x","trackingId":"T 1","weightOfParcel":-1,"colour":"red"}`), NEW_CHAIN_FIELDS, NEW_CHAIN_REQUIRED_FIELDS)
+
+	fields := make(map[string]bool)
+	for _, fieldError := range fieldErrors {
+		fields[fieldError.Field] = true
+	}
+	for _, name := range []string{"id", "trackingId", "weightOfParcel", "colour", "documentId"} {
+		if !fields[name] {
+			t.Errorf("no error for %s in %v", name, fieldErrors)
+		}
+	}
+}
+
+func TestUpdateDocumentValidatesTheDocumentId(t *testing.T) {
+	stub := newTestStub()
+	admin := newCaller("adm", CALLER_ROLE_1)
+	member := newCaller("m1", CALLER_ROLE_0)
+
+	custodyId := stub.newChain(t, member, "T1")
+	stub.expectError(t, ERR_BAD_ARGS, admin, "updateDocument", custodyId, "bad id!")
+	stub.expectError(t, ERR_BAD_ARGS, admin, "updateDocument", custodyId, "")
+	stub.mustInvoke(t, admin, "updateDocument", custodyId, "D2/2026")
+	if documentId := stub.getChain(t, custodyId).DocumentId; documentId != "D2/2026" {
+		t.Fatalf("DocumentId after updateDocument: %s", documentId)
+	}
+}